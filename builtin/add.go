@@ -1,74 +1,87 @@
 package builtin
 
 import (
+  "flag"
   "fmt"
   "github.com/easonliao/flea/core"
   "os"
-  "path"
   "path/filepath"
   "strings"
 )
 
 func UsageAdd() {
-  fmt.Println("Usage: flea add (<file>|<directory>)")
+  usage :=
+  `Usage: flea add [-f] <pathspec>...
+       flea add -p [<pathspec>...]
+
+  Adds the files matching the pathspec to the index, tracked files which have been
+  deleted are removed from the index.
+
+  -f: Allow adding files which are ignored by .fleaignore.
+  -p: Pick the hunks of the changes in tracked files to add interactively, the files in
+      working directory are not changed.
+  `
+  fmt.Println(usage)
   os.Exit(0)
 }
 
 func CmdAdd() error {
-  if len(os.Args) != 3 {
-    fmt.Println("Wrong number of arguments.")
-    UsageAdd()
+  flags := flag.NewFlagSet("add", 0)
+  force := flags.Bool("f", false, "force")
+  patch := flags.Bool("p", false, "patch")
+  flags.Parse(os.Args[2:])
+  if *patch {
+    return addPatch(flags.Args())
   }
-  addPath := os.Args[len(os.Args) - 1]
-  treePath := filepath.ToSlash(filepath.Join(core.GetPathPrefix(), addPath))
-  add(treePath)
-  return nil
-}
-
-func add(treePath string) error {
-  fstree := core.GetFsTree()
-  indextree := core.GetIndexTree()
-  node, err := fstree.Get(treePath)
-  if err != nil {
-    return err
+  if flags.NArg() == 0 {
+    fmt.Println("Nothing specified, nothing added.")
+    UsageAdd()
   }
-  if !node.IsDir() {
-    if hash, err := addFileToStore(treePath); err != nil {
-      return err
-    } else {
-      return indextree.MkFileAll(treePath, hash)
-    }
+  ps := ParsePathspecOrExit(flags.Args())
+  fsTree := core.GetFsTree()
+  idxTree := core.GetIndexTree()
+  if *force {
+    fsTree = fsTree.IncludeIgnored()
   } else {
-    nodePaths := make([]string, 0, 64)
-    fn := func(treePath string, node core.Node) error {
-      if strings.HasPrefix(path.Base(treePath), ".") {
-        if node.IsDir() {
-          return core.SkipDirNode
-        } else {
-          return nil
-        }
+    // Ignored files can only be added explicitly with -f.
+    for _, arg := range(flags.Args()) {
+      treePath := filepath.ToSlash(filepath.Join(core.GetPathPrefix(), arg))
+      if _, err := idxTree.Get(treePath); err != nil && !strings.ContainsAny(arg, ":*?[") &&
+         fsTree.IsIgnored(treePath) {
+        PrintAndExit(fmt.Sprintf("The path %s is ignored by .fleaignore, use -f to add it.",
+                                 arg))
       }
-      if !node.IsDir() {
-        nodePaths = append(nodePaths, treePath)
-      }
-      return nil
     }
-    // Finds all the paths of file node under treePath.
-    fstree.Traverse(fn, treePath)
-    if len(nodePaths) == 0 {
-      return ErrEmptyDir
+  }
+  files := ps.MatchFiles(fsTree)
+  // Tracked files which don't exist in working directory any more.
+  deleted := make([]string, 0)
+  for _, treePath := range(ps.MatchFiles(idxTree)) {
+    if node, err := fsTree.Get(treePath); err != nil || node.IsDir() {
+      deleted = append(deleted, treePath)
+    }
+  }
+  ensurePathspecMatched(ps, append(append([]string(nil), files...), deleted...))
+
+  for _, treePath := range(deleted) {
+    if err := deleteFromIndex(treePath); err != nil {
+      return err
     }
-    for _, nodePath := range(nodePaths) {
-      if hash, err := addFileToStore(nodePath); err != nil {
-        return err
-      } else {
-        if err := indextree.MkFileAll(nodePath, hash); err != nil {
-          return err
-        }
-      }
+    core.ResolveConflicts(treePath)
+  }
+  for _, treePath := range(files) {
+    hash, err := addFileToStore(treePath)
+    if err != nil {
+      return err
     }
-    return nil
+    node, _ := core.GetFsTree().Get(treePath)
+    if err = idxTree.MkFileAllMode(treePath, hash, node.GetMode()); err != nil {
+      return err
+    }
+    // Adding a path marks its conflicts as resolved.
+    core.ResolveConflicts(treePath)
   }
+  return nil
 }
 
 func addFileToStore(treePath string) ([]byte, error) {
@@ -0,0 +1,261 @@
+package builtin
+
+import (
+  "bufio"
+  "bytes"
+  "fmt"
+  "github.com/easonliao/flea/core"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+)
+
+const patchHelp =
+`y - stage this hunk
+n - do not stage this hunk
+q - quit, do not stage this hunk or any of the remaining ones
+a - stage this hunk and all later hunks in the file
+d - do not stage this hunk or any of the later hunks in the file
+s - split the current hunk into smaller hunks
+e - manually edit the current hunk
+? - print help`
+
+const editHunkHelp =
+`# ---
+# To remove '-' lines, make them ' ' lines (context).
+# To remove '+' lines, delete them.
+# Lines starting with # will be removed.
+# Context lines and '-' lines must not be added or removed, otherwise the hunk can't be
+# applied and you will be asked again.
+`
+
+// Decisions about a hunk.
+const (
+  hunkUndecided = iota
+  hunkStage
+  hunkSkip
+)
+
+// Stages the changes of tracked files matching the pathspec hunk by hunk, users are asked
+// whether to stage each of them. Working directory is left alone.
+func addPatch(paths []string) error {
+  ps := ParsePathspecOrExit(paths)
+  idxTree := core.GetIndexTree()
+  input := bufio.NewReader(os.Stdin)
+  conflicts := make(map[string]bool)
+  for _, treePath := range(core.ReadConflicts()) {
+    conflicts[treePath] = true
+  }
+  files := ps.MatchFiles(idxTree)
+  ensurePathspecMatched(ps, files)
+  changed := false
+  for _, treePath := range(files) {
+    idxNode, _ := idxTree.Get(treePath)
+    if idxNode.GetMode() == core.ModeGitlink {
+      // Submodules have no content to pick hunks from.
+      continue
+    }
+    fsNode, err := core.GetFsTree().Get(treePath)
+    if err == nil && !fsNode.IsDir() && bytes.Equal(idxNode.GetHashValue(),
+                                                   fsNode.GetHashValue()) &&
+       idxNode.GetMode() == fsNode.GetMode() {
+      continue
+    }
+    changed = true
+    if conflicts[treePath] {
+      fmt.Printf("Ignoring unmerged: %s\n", TreePathToRelFsPath(treePath))
+      continue
+    }
+    var quit bool
+    if err != nil || fsNode.IsDir() {
+      quit, err = addDeletionPatch(input, treePath, idxNode)
+    } else {
+      quit, err = addFilePatch(input, treePath, idxNode, fsNode)
+    }
+    if err != nil {
+      return err
+    }
+    if quit {
+      break
+    }
+  }
+  if !changed {
+    fmt.Println("No changes.")
+  }
+  return nil
+}
+
+// Asks whether to stage the deletion of the file, returns whether users quit.
+func addDeletionPatch(input *bufio.Reader, treePath string, idxNode core.Node) (bool, error) {
+  name := treePath[1:]
+  fmt.Printf("diff --flea a/%s b/%s\ndeleted file mode %s\n", name, name, idxNode.GetMode())
+  switch promptPatch(input, "Stage deletion [y,n,q,?]? ", "ynq") {
+  case 'y':
+    return false, deleteFromIndex(treePath)
+  case 'q':
+    return true, nil
+  }
+  return false, nil
+}
+
+// Asks which hunks of the file to stage and updates the index with them, returns whether
+// users quit.
+func addFilePatch(input *bufio.Reader, treePath string,
+                  idxNode, fsNode core.Node) (bool, error) {
+  name := treePath[1:]
+  fmt.Printf("diff --flea a/%s b/%s\n", name, name)
+  mode := idxNode.GetMode()
+  if mode != fsNode.GetMode() {
+    fmt.Printf("old mode %s\nnew mode %s\n", mode, fsNode.GetMode())
+    if (mode == core.ModeSymlink) != (fsNode.GetMode() == core.ModeSymlink) {
+      fmt.Println("Skipping typechange, use \"flea add\" to stage it.")
+      return false, nil
+    }
+    switch promptPatch(input, "Stage mode change [y,n,q,?]? ", "ynq") {
+    case 'y':
+      mode = fsNode.GetMode()
+    case 'q':
+      return true, nil
+    }
+  }
+  quit := false
+  dataA, err := readNodeData(idxNode)
+  if err != nil {
+    return false, err
+  }
+  dataB, err := fsNode.GetData()
+  if err != nil {
+    return false, err
+  }
+  data := dataA
+  if core.IsBinary(dataA) || core.IsBinary(dataB) {
+    fmt.Println("Only binary files changed.")
+  } else if !bytes.Equal(dataA, dataB) {
+    fmt.Printf("--- a/%s\n+++ b/%s\n", name, name)
+    lines := core.SplitLines(dataA)
+    hunks := core.GetHunks(core.DiffLines(lines, core.SplitLines(dataB)), 3)
+    var staged []core.Hunk
+    staged, quit = selectHunks(input, lines, hunks)
+    data = core.JoinLines(core.ApplyHunks(lines, staged))
+  }
+  if mode == idxNode.GetMode() && bytes.Equal(data, dataA) {
+    return quit, nil
+  }
+  hash, err := core.GetCAStore().StoreBlob(data)
+  if err != nil {
+    return false, err
+  }
+  return quit, core.GetIndexTree().MkFileAllMode(treePath, hash, mode)
+}
+
+// Asks users which of the hunks to stage, returns the staged hunks and whether users quit.
+func selectHunks(input *bufio.Reader, lines []string, hunks []core.Hunk) ([]core.Hunk, bool) {
+  decisions := make([]int, len(hunks))
+  quit := false
+  for i := 0; i < len(hunks) && !quit; {
+    if decisions[i] != hunkUndecided {
+      i++
+      continue
+    }
+    hunk := hunks[i]
+    choices := "ynqade"
+    prompt := "Stage this hunk [y,n,q,a,d,e,?]? "
+    if len(core.SplitHunk(hunk, 3)) > 1 {
+      choices += "s"
+      prompt = "Stage this hunk [y,n,q,a,d,s,e,?]? "
+    }
+    fmt.Print(formatHunk(hunk))
+    answer := promptPatch(input, fmt.Sprintf("(%d/%d) %s", i + 1, len(hunks), prompt), choices)
+    switch answer {
+    case 'y':
+      decisions[i] = hunkStage
+    case 'n':
+      decisions[i] = hunkSkip
+    case 'a', 'd', 'q':
+      // Decides this hunk and all the undecided ones after it.
+      decision := hunkSkip
+      if answer == 'a' {
+        decision = hunkStage
+      }
+      quit = answer == 'q'
+      for j := i; j < len(hunks); j++ {
+        if decisions[j] == hunkUndecided {
+          decisions[j] = decision
+        }
+      }
+    case 's':
+      subs := core.SplitHunk(hunk, 3)
+      fmt.Printf("Split into %d hunks.\n", len(subs))
+      hunks = append(hunks[:i], append(subs, hunks[i + 1:]...)...)
+      decisions = append(decisions[:i], append(make([]int, len(subs)), decisions[i + 1:]...)...)
+    case 'e':
+      edited, err := editHunk(lines, hunk)
+      if err != nil {
+        fmt.Println(err.Error())
+        continue
+      }
+      hunks[i] = edited
+      decisions[i] = hunkStage
+    }
+  }
+  staged := make([]core.Hunk, 0)
+  for i, hunk := range(hunks) {
+    if decisions[i] == hunkStage {
+      staged = append(staged, hunk)
+    }
+  }
+  return staged, quit
+}
+
+// Prints the prompt and reads the answer until it's one of the choices, the help is
+// printed for "?". End of input is taken as "q".
+func promptPatch(input *bufio.Reader, prompt, choices string) byte {
+  for {
+    fmt.Print(prompt)
+    line, err := input.ReadString('\n')
+    line = strings.TrimSpace(line)
+    if line == "" && err != nil {
+      fmt.Println("")
+      return 'q'
+    }
+    if len(line) == 1 && strings.IndexByte(choices, line[0]) != -1 {
+      return line[0]
+    }
+    // Only prints the help of the choices given.
+    for _, help := range(strings.Split(patchHelp, "\n")) {
+      if strings.IndexByte(choices + "?", help[0]) != -1 {
+        fmt.Println(help)
+      }
+    }
+  }
+}
+
+// Lets users edit the hunk in the editor, returns the edited hunk or ErrHunkNotApply if
+// it can't be applied to the lines.
+func editHunk(lines []string, hunk core.Hunk) (core.Hunk, error) {
+  fileName := filepath.Join(core.GetFleaDirectory(), "ADD_EDIT.patch")
+  content := "# Manual hunk edit mode.\n" + formatHunk(hunk) + editHunkHelp
+  if err := ioutil.WriteFile(fileName, []byte(content), 0666); err != nil {
+    return core.Hunk{}, err
+  }
+  defer os.Remove(fileName)
+  if err := launchEditor(fileName); err != nil {
+    return core.Hunk{}, err
+  }
+  data, err := ioutil.ReadFile(fileName)
+  if err != nil {
+    return core.Hunk{}, err
+  }
+  var body bytes.Buffer
+  for _, line := range(core.SplitLines(data)) {
+    if !strings.HasPrefix(line, "#") {
+      body.WriteString(line)
+    }
+  }
+  edited, err := core.ParseHunk(body.String(), lines, hunk)
+  if err == core.ErrHunkNotApply {
+    return core.Hunk{}, ErrEditedHunk
+  }
+  return edited, err
+}
@@ -0,0 +1,241 @@
+package builtin
+
+import (
+  "archive/tar"
+  "archive/zip"
+  "bufio"
+  "compress/gzip"
+  "flag"
+  "fmt"
+  "github.com/easonliao/flea/core"
+  "io"
+  "os"
+  "path"
+  "strings"
+  "time"
+)
+
+func UsageArchive() {
+  usage :=
+  `Usage: flea archive [--format=tar|tar.gz|zip] [--prefix=<dir>/] [-o <file>] <revision> [<pathspec>...]
+
+  Creates an archive of the files in the tree of the revision, optionally only the files
+  matching the pathspec. The modification time of all the entries is the commit time,
+  so archiving the same commit always produces the same output.
+
+  --format: The format of the archive, it's guessed from the name of the output file if
+            not given, otherwise it's tar.
+  --prefix: Prepended to the paths in the archive.
+  -o: Write the archive to the file instead of standard output.
+  `
+  fmt.Println(usage)
+  os.Exit(1)
+}
+
+// Writes the entries of an archive, entries are added with paths in the archive.
+type archiveWriter interface {
+  AddDir(name string) error
+  AddFile(name string, mode core.FileMode, data []byte) error
+  Close() error
+}
+
+func CmdArchive() error {
+  flags := flag.NewFlagSet("archive", 0)
+  flags.Usage = UsageArchive
+  format := flags.String("format", "", "format")
+  prefix := flags.String("prefix", "", "prefix")
+  output := flags.String("o", "", "output file")
+  flags.Parse(os.Args[2:])
+  if flags.NArg() == 0 {
+    UsageArchive()
+  }
+  if *format == "" {
+    *format = guessArchiveFormat(*output)
+  }
+  newWriter, ok := archiveWriters[*format]
+  if !ok {
+    PrintAndExit(fmt.Sprintf("Unknown archive format: %s", *format))
+  }
+  commit, _ := ResolveCommitOrExit(flags.Arg(0))
+  ps := ParsePathspecOrExit(flags.Args()[1:])
+  tree := commit.GetCATree()
+  files := ps.MatchFiles(tree)
+  ensurePathspecMatched(ps, files)
+
+  var out io.Writer = os.Stdout
+  if *output != "" {
+    file, err := os.Create(*output)
+    if err != nil {
+      return err
+    }
+    defer file.Close()
+    out = file
+  }
+  buf := bufio.NewWriter(out)
+  mtime := commit.GetCommitter().When
+  if mtime.IsZero() {
+    mtime = time.Unix(0, 0)
+  }
+  writer := newWriter(buf, mtime)
+  if err := writeArchive(writer, tree, files, *prefix); err != nil {
+    return err
+  }
+  if err := writer.Close(); err != nil {
+    return err
+  }
+  return buf.Flush()
+}
+
+// Guesses the format from the extension of the file name, it's tar by default.
+func guessArchiveFormat(name string) string {
+  switch {
+  case strings.HasSuffix(name, ".zip"):
+    return "zip"
+  case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+    return "tar.gz"
+  }
+  return "tar"
+}
+
+// Constructors of the archive writers by format name.
+var archiveWriters = map[string]func(out io.Writer, mtime time.Time) archiveWriter{
+  "tar"    : newTarArchiveWriter,
+  "tar.gz" : newTarGzArchiveWriter,
+  "tgz"    : newTarGzArchiveWriter,
+  "zip"    : newZipArchiveWriter,
+}
+
+func newTarArchiveWriter(out io.Writer, mtime time.Time) archiveWriter {
+  return &tarArchiveWriter{writer : tar.NewWriter(out), mtime : mtime}
+}
+
+func newTarGzArchiveWriter(out io.Writer, mtime time.Time) archiveWriter {
+  gz := gzip.NewWriter(out)
+  gz.ModTime = mtime
+  return &tarArchiveWriter{writer : tar.NewWriter(gz), mtime : mtime, gz : gz}
+}
+
+func newZipArchiveWriter(out io.Writer, mtime time.Time) archiveWriter {
+  return &zipArchiveWriter{writer : zip.NewWriter(out), mtime : mtime}
+}
+
+// Adds the files of the tree to the archive, the files must be sorted so the parent
+// directories are added right before their first files.
+func writeArchive(writer archiveWriter, tree core.Tree, files []string, prefix string) error {
+  if strings.HasSuffix(prefix, "/") {
+    if err := writer.AddDir(prefix); err != nil {
+      return err
+    }
+  }
+  added := make(map[string]bool)
+  for _, treePath := range(files) {
+    dirs := make([]string, 0)
+    for dir := path.Dir(treePath); dir != "/" && !added[dir]; dir = path.Dir(dir) {
+      dirs = append(dirs, dir)
+      added[dir] = true
+    }
+    for i := len(dirs) - 1; i >= 0; i-- {
+      if err := writer.AddDir(prefix + dirs[i][1:] + "/"); err != nil {
+        return err
+      }
+    }
+    node, _ := tree.Get(treePath)
+    if node.GetMode() == core.ModeGitlink {
+      // Submodules are not archived, they are left as empty directories.
+      if err := writer.AddDir(prefix + treePath[1:] + "/"); err != nil {
+        return err
+      }
+      continue
+    }
+    data, err := node.GetData()
+    if err != nil {
+      return err
+    }
+    if err = writer.AddFile(prefix + treePath[1:], node.GetMode(), data); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+type tarArchiveWriter struct {
+  writer *tar.Writer
+  mtime time.Time
+  // The gzip writer under the tar writer, nil for plain tar.
+  gz *gzip.Writer
+}
+
+func (w *tarArchiveWriter) AddDir(name string) error {
+  return w.writer.WriteHeader(&tar.Header{
+    Typeflag : tar.TypeDir,
+    Name     : name,
+    Mode     : 0755,
+    ModTime  : w.mtime,
+  })
+}
+
+func (w *tarArchiveWriter) AddFile(name string, mode core.FileMode, data []byte) error {
+  if mode == core.ModeSymlink {
+    return w.writer.WriteHeader(&tar.Header{
+      Typeflag : tar.TypeSymlink,
+      Name     : name,
+      Linkname : string(data),
+      Mode     : 0777,
+      ModTime  : w.mtime,
+    })
+  }
+  err := w.writer.WriteHeader(&tar.Header{
+    Typeflag : tar.TypeReg,
+    Name     : name,
+    Size     : int64(len(data)),
+    Mode     : int64(mode.Perm()),
+    ModTime  : w.mtime,
+  })
+  if err != nil {
+    return err
+  }
+  _, err = w.writer.Write(data)
+  return err
+}
+
+func (w *tarArchiveWriter) Close() error {
+  if err := w.writer.Close(); err != nil {
+    return err
+  }
+  if w.gz != nil {
+    return w.gz.Close()
+  }
+  return nil
+}
+
+type zipArchiveWriter struct {
+  writer *zip.Writer
+  mtime time.Time
+}
+
+func (w *zipArchiveWriter) AddDir(name string) error {
+  header := &zip.FileHeader{Name : name, Modified : w.mtime}
+  header.SetMode(os.ModeDir | 0755)
+  _, err := w.writer.CreateHeader(header)
+  return err
+}
+
+func (w *zipArchiveWriter) AddFile(name string, mode core.FileMode, data []byte) error {
+  header := &zip.FileHeader{Name : name, Modified : w.mtime, Method : zip.Deflate}
+  if mode == core.ModeSymlink {
+    // Symlinks are stored with the target as the content.
+    header.SetMode(os.ModeSymlink | 0777)
+  } else {
+    header.SetMode(mode.Perm())
+  }
+  file, err := w.writer.CreateHeader(header)
+  if err != nil {
+    return err
+  }
+  _, err = file.Write(data)
+  return err
+}
+
+func (w *zipArchiveWriter) Close() error {
+  return w.writer.Close()
+}
@@ -0,0 +1,229 @@
+package builtin
+
+import (
+  "encoding/hex"
+  "fmt"
+  "github.com/easonliao/flea/core"
+  "os"
+  "os/exec"
+  "strings"
+)
+
+func UsageBisect() {
+  usage :=
+  `Usage: flea bisect start [<bad> [<good>...]]
+       flea bisect (good|skip) [<revision>...]
+       flea bisect bad [<revision>]
+       flea bisect reset [<revision>]
+       flea bisect log
+       flea bisect run <cmd> [<arg>...]
+
+  Finds the commit which introduced a regression by binary search. Once a bad commit and
+  a good commit are known, the commits between them are checked out one by one for you to
+  test, until the first bad commit is found. The revisions are HEAD by default.
+
+  start: Start bisecting, optionally with the bad and good commits.
+  good, bad: Mark the commits as good or bad.
+  skip: Mark the commits as untestable, another commit near them is picked instead.
+  reset: Finish bisecting and go back to where HEAD was before start, or <revision>.
+  log: Show what has been done.
+  run: Test the commits by running the command, its exit code tells how the commit is:
+       0 is good, 125 is skip, 1 to 127 is bad. Other codes stop bisecting.
+  `
+  fmt.Println(usage)
+  os.Exit(1)
+}
+
+func CmdBisect() error {
+  args := os.Args[2:]
+  if len(args) == 0 {
+    UsageBisect()
+  }
+  subcommand, args := args[0], args[1:]
+  if subcommand == "start" {
+    startBisect(args)
+    return nil
+  }
+  bisect, err := core.LoadBisect()
+  if err == core.ErrNoBisect {
+    PrintAndExit("Not bisecting, run \"flea bisect start\" first.")
+  } else if err != nil {
+    return err
+  }
+  switch subcommand {
+  case "good", "skip":
+    if len(args) == 0 {
+      args = []string{"HEAD"}
+    }
+    for _, rev := range(args) {
+      markBisect(bisect, subcommand, rev)
+    }
+    nextBisectStep(bisect)
+  case "bad":
+    if len(args) > 1 {
+      UsageBisect()
+    }
+    rev := "HEAD"
+    if len(args) == 1 {
+      rev = args[0]
+    }
+    markBisect(bisect, subcommand, rev)
+    nextBisectStep(bisect)
+  case "reset":
+    if len(args) > 1 {
+      UsageBisect()
+    }
+    resetBisect(bisect, args)
+  case "log":
+    fmt.Print(core.ReadBisectLog())
+  case "run":
+    if len(args) == 0 {
+      UsageBisect()
+    }
+    runBisect(bisect, args)
+  default:
+    UsageBisect()
+  }
+  return nil
+}
+
+func startBisect(args []string) {
+  if core.HasBisect() {
+    PrintAndExit("Already bisecting, run \"flea bisect reset\" first.")
+  }
+  ensureNoLocalChanges("bisect")
+  var start string
+  if branch, err := core.GetCurrentBranch(); err == nil {
+    start = "ref:" + branch
+  } else if head, err := core.GetHeadHash(); err == nil {
+    start = hex.EncodeToString(head)
+  } else {
+    PrintAndExit("Can't bisect, there's no commit yet.")
+  }
+  // Resolves the revisions before anything is changed.
+  for _, rev := range(args) {
+    ResolveCommitOrExit(rev)
+  }
+  bisect, err := core.StartBisect(start)
+  if err != nil {
+    PrintAndExit(err.Error())
+  }
+  core.AppendBisectLog("flea bisect start")
+  for i, rev := range(args) {
+    if i == 0 {
+      markBisect(bisect, "bad", rev)
+    } else {
+      markBisect(bisect, "good", rev)
+    }
+  }
+  nextBisectStep(bisect)
+}
+
+// Marks the commit of the revision as good, bad or skip.
+func markBisect(bisect *core.Bisect, term, rev string) {
+  commit, hash := ResolveCommitOrExit(rev)
+  switch term {
+  case "good":
+    bisect.Good = append(bisect.Good, hash)
+  case "bad":
+    bisect.Bad = hash
+  case "skip":
+    bisect.Skip = append(bisect.Skip, hash)
+  }
+  if err := bisect.Save(); err != nil {
+    PrintAndExit(err.Error())
+  }
+  core.AppendBisectLog(fmt.Sprintf("# %s: [%x] %s", term, hash, core.FirstLine(commit.Comment)))
+  core.AppendBisectLog(fmt.Sprintf("flea bisect %s %x", term, hash))
+}
+
+// Checks out the next commit to test, or prints the first bad commit. Returns whether
+// bisecting is done.
+func nextBisectStep(bisect *core.Bisect) bool {
+  step, err := bisect.NextStep()
+  switch {
+  case err == core.ErrBisectNotReady:
+    fmt.Println("Waiting for both good and bad commits.")
+    return false
+  case err == core.ErrBisectBadIsGood:
+    PrintAndExit("The bad commit is an ancestor of a good commit, please check the commits.")
+  case err != nil:
+    PrintAndExit(err.Error())
+  }
+  if step.FirstBad != nil {
+    commit, _ := core.GetCommitObject(step.FirstBad)
+    fmt.Printf("%x is the first bad commit\n", step.FirstBad)
+    printCommit(commit)
+    core.AppendBisectLog(fmt.Sprintf("# first bad commit: [%x] %s", step.FirstBad,
+                                     core.FirstLine(commit.Comment)))
+    return true
+  }
+  if step.Next == nil {
+    fmt.Println("There are only skipped commits left to test.")
+    fmt.Println("The first bad commit could be any of:")
+    for _, hash := range(step.Skipped) {
+      fmt.Printf("%x\n", hash)
+    }
+    return true
+  }
+  commit, _ := core.GetCommitObject(step.Next)
+  fmt.Printf("Bisecting: %s left to test after this (roughly %s)\n",
+             plural(step.Remaining, "revision"), plural(step.Steps, "step"))
+  detachHead(commit, step.Next, fmt.Sprintf("checkout: moving from %s to %x",
+                                            describeHead(), step.Next))
+  fmt.Printf("[%x] %s\n", step.Next, core.FirstLine(commit.Comment))
+  return false
+}
+
+// Finishes bisecting and checks out the revision, or the original HEAD if there's none.
+func resetBisect(bisect *core.Bisect, args []string) {
+  reason := "bisect reset: moving from " + describeHead()
+  if len(args) == 1 && core.IsValidBranch(args[0]) {
+    switchToBranch(args[0], reason + " to " + args[0])
+  } else if len(args) == 1 {
+    commit, hash := ResolveCommitOrExit(args[0])
+    detachHead(commit, hash, reason + " to " + args[0])
+  } else if strings.HasPrefix(bisect.Start, "ref:") {
+    branch := bisect.Start[len("ref:"):]
+    switchToBranch(branch, reason + " to " + branch)
+  } else if hash, err := hex.DecodeString(bisect.Start); err == nil {
+    commit, _ := core.GetCommitObject(hash)
+    detachHead(commit, hash, fmt.Sprintf("%s to %x", reason, hash))
+  }
+  core.RemoveBisect()
+  fmt.Printf("HEAD is now at %s.\n", describeHeadShort())
+}
+
+// Tests the commits by running the command until the first bad commit is found.
+func runBisect(bisect *core.Bisect, args []string) {
+  if _, err := bisect.NextStep(); err != nil {
+    PrintAndExit("Can't run, bisect needs both a good and a bad commit.")
+  }
+  for {
+    fmt.Printf("running %s\n", strings.Join(args, " "))
+    cmd := exec.Command(args[0], args[1:]...)
+    cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+    code := 0
+    if err := cmd.Run(); err != nil {
+      exitErr, ok := err.(*exec.ExitError)
+      if !ok {
+        PrintAndExit(fmt.Sprintf("Failed to run %s: %s", args[0], err))
+      }
+      code = exitErr.ExitCode()
+    }
+    term := "good"
+    switch {
+    case code == 125:
+      term = "skip"
+    case code < 0 || code >= 128:
+      PrintAndExit(fmt.Sprintf("Bisect run stopped, the command exited with %d.", code))
+    case code != 0:
+      term = "bad"
+    }
+    markBisect(bisect, term, "HEAD")
+    if nextBisectStep(bisect) {
+      fmt.Println("bisect run success")
+      return
+    }
+  }
+}
@@ -0,0 +1,167 @@
+package builtin
+
+import (
+  "bytes"
+  "flag"
+  "fmt"
+  "github.com/easonliao/flea/core"
+  "os"
+  "strconv"
+  "strings"
+)
+
+func UsageBlame() {
+  usage :=
+  `Usage: flea blame [-L <start>,<end>] [--porcelain] <path> [<revision>]
+
+  Shows the commit which last changed each line of the file at <revision>, HEAD by
+  default, along with its author, date and the line number.
+
+  -L <start>,<end>: Only show the lines from <start> to <end>, 1-based and inclusive.
+                    <end> can be +<count>, and the end of the file if it's omitted.
+  --porcelain: Show the result in a format for programs. Each line is preceded by a line
+               "<hash> <orig-line> <line> [<count>]", where the count of lines of the
+               group is given for the first line of each group of lines from the same
+               commit. The first time a commit appears its information follows, e.g.
+               "author <name>" and "summary <subject>". The content of the line is
+               prefixed with a tab.
+  `
+  fmt.Println(usage)
+  os.Exit(1)
+}
+
+func CmdBlame() error {
+  flags := flag.NewFlagSet("blame", 0)
+  lineRange := flags.String("L", "", "line range")
+  porcelain := flags.Bool("porcelain", false, "porcelain")
+  flags.Usage = UsageBlame
+  flags.Parse(os.Args[2:])
+  if flags.NArg() < 1 || flags.NArg() > 2 {
+    UsageBlame()
+  }
+  rev := "HEAD"
+  if flags.NArg() == 2 {
+    rev = flags.Arg(1)
+  }
+  _, hash := ResolveCommitOrExit(rev)
+  treePath := RelFsPathToTreePath(GetRelFsPath(flags.Arg(0)))
+  if strings.HasPrefix(treePath, "/..") {
+    PrintAndExit(fmt.Sprintf("%s is outside the repository.", flags.Arg(0)))
+  }
+  lines, err := core.Blame(hash, treePath)
+  if err == core.ErrPathNotExist || err == core.ErrNotFile {
+    PrintAndExit(fmt.Sprintf("There's no file %s in %s.", flags.Arg(0), rev))
+  } else if err != nil {
+    return err
+  }
+  if *lineRange != "" {
+    start, end, err := parseLineRange(*lineRange, len(lines))
+    if err != nil {
+      PrintAndExit(fmt.Sprintf("Invalid line range: %s", *lineRange))
+    }
+    lines = lines[start - 1:end]
+  }
+  if *porcelain {
+    printBlamePorcelain(lines, treePath)
+  } else {
+    printBlame(lines)
+  }
+  return nil
+}
+
+// Parses the range of lines in the form of "<start>,<end>", "<start>,+<count>" or
+// "<start>,", the range is checked against the number of lines.
+func parseLineRange(lineRange string, total int) (start, end int, err error) {
+  parts := strings.SplitN(lineRange, ",", 2)
+  if start, err = strconv.Atoi(parts[0]); err != nil {
+    return
+  }
+  end = total
+  if len(parts) == 2 && parts[1] != "" {
+    if strings.HasPrefix(parts[1], "+") {
+      var count int
+      if count, err = strconv.Atoi(parts[1][1:]); err != nil {
+        return
+      }
+      end = start + count - 1
+    } else if end, err = strconv.Atoi(parts[1]); err != nil {
+      return
+    }
+  }
+  if start < 1 || start > total || end < start {
+    err = ErrInvalidLineRange
+  }
+  if end > total {
+    end = total
+  }
+  return
+}
+
+// Prints the lines in the way of "<hash> (<author> <date> <line>) <content>".
+func printBlame(lines []core.BlameLine) {
+  if len(lines) == 0 {
+    return
+  }
+  commits := make(map[string]*core.Commit)
+  authorWidth, lineWidth := 0, len(fmt.Sprint(lines[len(lines) - 1].Line))
+  for _, line := range(lines) {
+    if commits[string(line.Commit)] == nil {
+      commits[string(line.Commit)], _ = core.GetCommitObject(line.Commit)
+    }
+    if name := commits[string(line.Commit)].GetAuthor().Name; len(name) > authorWidth {
+      authorWidth = len(name)
+    }
+  }
+  for _, line := range(lines) {
+    author := commits[string(line.Commit)].GetAuthor()
+    date := ""
+    if !author.When.IsZero() {
+      date = author.When.Format("2006-01-02 15:04:05 -0700")
+    }
+    fmt.Printf("%x (%-*s %s %*d) %s\n", line.Commit[:4], authorWidth, author.Name, date,
+               lineWidth, line.Line, strings.TrimSuffix(line.Text, "\n"))
+  }
+}
+
+// Prints the lines in porcelain format, see UsageBlame.
+func printBlamePorcelain(lines []core.BlameLine, treePath string) {
+  shown := make(map[string]bool)
+  for i, line := range(lines) {
+    // The lines of a group are consecutive in both the blamed file and the commit.
+    first := i == 0 || !bytes.Equal(lines[i - 1].Commit, line.Commit) ||
+             lines[i - 1].OrigLine + 1 != line.OrigLine
+    if first {
+      count := 1
+      for j := i + 1; j < len(lines) && bytes.Equal(lines[j].Commit, line.Commit) &&
+          lines[j].OrigLine == lines[j - 1].OrigLine + 1; j++ {
+        count++
+      }
+      fmt.Printf("%x %d %d %d\n", line.Commit, line.OrigLine, line.Line, count)
+    } else {
+      fmt.Printf("%x %d %d\n", line.Commit, line.OrigLine, line.Line)
+    }
+    if !shown[string(line.Commit)] {
+      shown[string(line.Commit)] = true
+      commit, _ := core.GetCommitObject(line.Commit)
+      printPorcelainSignature("author", commit.GetAuthor())
+      printPorcelainSignature("committer", commit.GetCommitter())
+      fmt.Printf("summary %s\n", core.FirstLine(commit.Comment))
+      if commit.PrevCommit == nil {
+        fmt.Println("boundary")
+      }
+      fmt.Printf("filename %s\n", treePath[1:])
+    } else if first {
+      fmt.Printf("filename %s\n", treePath[1:])
+    }
+    fmt.Printf("\t%s\n", strings.TrimSuffix(line.Text, "\n"))
+  }
+}
+
+func printPorcelainSignature(role string, sig core.Signature) {
+  fmt.Printf("%s %s\n", role, sig.Name)
+  fmt.Printf("%s-mail <%s>\n", role, sig.Email)
+  if !sig.When.IsZero() {
+    fmt.Printf("%s-time %d\n", role, sig.When.Unix())
+    fmt.Printf("%s-tz %s\n", role, sig.When.Format("-0700"))
+  }
+}
@@ -1,7 +1,6 @@
 package builtin
 
 import (
-  "encoding/hex"
   "flag"
   "fmt"
   "github.com/easonliao/flea/core"
@@ -10,7 +9,7 @@ import (
 
 func UsageCatFile() {
   usage :=
-  `Usage: flea cat-file [-t] <object>
+  `Usage: flea cat-file [-t] <revision>
 
   -t: Instead of the content, show the object type identified by <object>
   `
@@ -26,28 +25,19 @@ func CmdCatFile() error {
   flags := flag.NewFlagSet("cat-file", 0)
   printType := flags.Bool("t", false, "file type")
   flags.Parse(os.Args[2:])
-  hashPrefix :=  os.Args[len(os.Args) - 1]
-  hash, err := hex.DecodeString(hashPrefix)
+  if flags.NArg() != 1 {
+    UsageCatFile()
+  }
+  hash := ResolveRevisionOrExit(flags.Arg(0))
+  fType, data, err := core.GetCAStore().Get(hash)
   if err != nil {
-    fmt.Println("Invalid hash values.")
+    fmt.Printf("Error: %s\n", err.Error())
     os.Exit(1)
   }
-  store := core.GetCAStore()
-  hashs := store.GetMatchedHashs(hash)
-  if len(hashs) > 1 {
-    fmt.Printf("More than one file match %s\n", hashPrefix)
-    os.Exit(1)
-  } else if len(hashs) == 1 {
-    fType, data, err := store.Get(hashs[0])
-    if err != nil {
-      fmt.Printf("Error: %s\n", err.Error())
-      os.Exit(1)
-    }
-    if *printType {
-      fmt.Println(fType)
-    } else {
-      fmt.Println(string(data))
-    }
+  if *printType {
+    fmt.Println(fType)
+  } else {
+    fmt.Println(string(data))
   }
   return nil
 }
@@ -4,7 +4,6 @@ import (
   "bytes"
   "encoding/hex"
   "fmt"
-  "io/ioutil"
   "github.com/easonliao/flea/core"
   "os"
   "path/filepath"
@@ -12,53 +11,97 @@ import (
 )
 
 func UsageCheckout() {
-  fmt.Println("flea checkout (<branch>|<commit-hash>)")
+  usage :=
+  `Usage: flea checkout (<branch>|<revision>)
+       flea checkout [<revision>] -- <pathspec>...
+
+  With paths, the files matching the pathspec in working directory are restored from
+  the index, or from <revision> in which case the index is also updated.
+  `
+  fmt.Println(usage)
   os.Exit(1)
 }
 
 func CmdCheckout() error {
+  if args, paths, dashDash := splitDashDash(os.Args[2:]); dashDash {
+    if len(args) > 1 || len(paths) == 0 {
+      UsageCheckout()
+    }
+    checkoutPaths(args, paths)
+    return nil
+  }
   if len(os.Args) != 3 {
     UsageCheckout()
   }
   dest := os.Args[2]
-  var commit *core.Commit
+  reason := fmt.Sprintf("checkout: moving from %s to %s", describeHead(), dest)
 
   if core.IsValidBranch(dest) {
     // Checkout to a branch.
-    var err error
-    head := core.GetBranchHead(dest)
-    commit, err = core.GetCommitObject(head)
-    if err == core.ErrNoMatch {
-      fmt.Println("The head of the branch doesn't point to a valid commit object")
-      os.Exit(1)
-    }
-    fmt.Printf("checking out to %s branch with hash %x\n", dest, head)
-    deleteAllFilesInCurrentCommit()
-    restoreRepoFromCommit(commit)
-    core.WriteHeadFile([]byte("ref:" + dest))
+    fmt.Printf("checking out to %s branch with hash %x\n", dest, core.GetBranchHead(dest))
+    switchToBranch(dest, reason)
   } else {
     // Checkout to a commit.
-    hashPrefix, err := hex.DecodeString(dest)
-    if err != nil {
-      fmt.Println("Not a valid hash string.")
-      os.Exit(1)
-    }
-    hashs := core.GetCAStore().GetMatchedHashs(hashPrefix)
-    if len(hashs) > 1 {
-      fmt.Println("More than one object match the hash value.")
-      os.Exit(1)
+    commit, hash := ResolveCommitOrExit(dest)
+    fmt.Printf("checking out to commit %x\n", hash)
+    detachHead(commit, hash, reason)
+  }
+  return nil
+}
+
+// Restores the index and working directory from the head of the branch and attaches HEAD
+// to the branch.
+func switchToBranch(branch, reason string) {
+  commit, err := core.GetCommitObject(core.GetBranchHead(branch))
+  if err == core.ErrNoMatch {
+    PrintAndExit("The head of the branch doesn't point to a valid commit object")
+  }
+  deleteAllFilesInCurrentCommit()
+  restoreRepoFromCommit(commit)
+  core.WriteHeadFile([]byte("ref:" + branch), reason)
+}
+
+// Restores the index and working directory from the commit and detaches HEAD at it.
+func detachHead(commit *core.Commit, hash []byte, reason string) {
+  deleteAllFilesInCurrentCommit()
+  restoreRepoFromCommit(commit)
+  core.WriteHeadFile([]byte(hex.EncodeToString(hash)), reason)
+}
+
+// Restores the files matching the pathspec from the index, or the revision if it's given.
+func checkoutPaths(revs, paths []string) {
+  ps := ParsePathspecOrExit(paths)
+  idxTree := core.GetIndexTree()
+  var tree core.Tree = idxTree
+  if len(revs) == 1 {
+    commit, _ := ResolveCommitOrExit(revs[0])
+    tree = commit.GetCATree()
+  }
+  files := ps.MatchFiles(tree)
+  ensurePathspecMatched(ps, files)
+  for _, treePath := range(files) {
+    node, _ := tree.Get(treePath)
+    if len(revs) == 1 {
+      if err := idxTree.MkFileAllMode(treePath, node.GetHashValue(),
+                                      node.GetMode()); err != nil {
+        PrintAndExit(err.Error())
+      }
     }
-    if len(hashs) == 0 {
-      fmt.Println("No matched commit object found.")
-      os.Exit(1)
+    if err := restoreWorkFile(tree, treePath); err != nil {
+      PrintAndExit(err.Error())
     }
-    commit, _ = core.GetCommitObject(hashs[0])
-    fmt.Printf("checking out to commit %x\n", commit.GetCommitHash())
-    deleteAllFilesInCurrentCommit()
-    restoreRepoFromCommit(commit)
-    core.WriteHeadFile([]byte(hex.EncodeToString(hashs[0])))
   }
-  return nil
+  fmt.Printf("Updated %d path(s).\n", len(files))
+}
+
+// Writes the file of the tree to working directory, replacing what's at the path.
+func restoreWorkFile(tree core.Tree, treePath string) error {
+  fsPath := filepath.Join(core.GetRepoDirectory(), TreePathToRelFsPath(treePath))
+  // A directory may be replaced by the file.
+  if fi, err := os.Lstat(fsPath); err == nil && fi.IsDir() {
+    os.RemoveAll(fsPath)
+  }
+  return writeSubtreeToWorkDir(tree, treePath)
 }
 
 func deleteAllFilesInCurrentCommit() {
@@ -69,13 +112,22 @@ func deleteAllFilesInCurrentCommit() {
   } else if err != nil {
     panic(err.Error())
   }
-  tree := commit.GetCATree()
+  deleteFilesOfTrees(commit.GetCATree())
+}
+
+// Deletes all the files and directories of the trees from working directory. Directories
+// which are not empty after deleting the files are kept.
+func deleteFilesOfTrees(trees ...core.Tree) {
   paths := make([]string, 0, 64)
   fn := func(treePath string, node core.Node) error {
-    paths = append(paths, treePath)
+    if treePath != "/" {
+      paths = append(paths, treePath)
+    }
     return nil
   }
-  tree.Traverse(fn, "/")
+  for _, tree := range(trees) {
+    tree.Traverse(fn, "/")
+  }
   // Sorts the path in descending order so we'll delete files/dirs in reverse order of
   // the namespace hierarchy.
   sort.Sort(sort.Reverse(sort.StringSlice(paths)))
@@ -101,10 +153,9 @@ func restoreRepoFromCommit(commit *core.Commit) {
     } else {
       data, _  := node.GetData()
       // Restores to index file.
-      idxTree.MkFile(treePath, node.GetHashValue())
+      idxTree.MkFileAllMode(treePath, node.GetHashValue(), node.GetMode())
       // Restores to working directory.
-      err := ioutil.WriteFile(fsPath, data, 0666)
-      return err
+      return writeWorkFile(fsPath, data, node.GetMode())
     }
     return nil
   }
@@ -0,0 +1,85 @@
+package builtin
+
+import (
+  "flag"
+  "fmt"
+  "github.com/easonliao/flea/core"
+  "os"
+)
+
+func UsageCherryPick() {
+  usage :=
+  `Usage: flea cherry-pick <revision>...
+       flea cherry-pick (--continue|--skip|--abort)
+
+  Applies the changes introduced by the commits onto HEAD, each of them creates a new
+  commit with the author and message of the original commit. A revision can be a range
+  in the form of <rev1>..<rev2>, which picks the commits reachable from <rev2> but not
+  from <rev1>, oldest first.
+
+  --continue: Go on after the conflicts have been resolved and marked with
+              "flea add <path>".
+  --skip: Skip the commit which stopped with conflicts.
+  --abort: Cancel the operation and restore HEAD, the index and working directory.
+  `
+  fmt.Println(usage)
+  os.Exit(1)
+}
+
+func CmdCherryPick() error {
+  flags := flag.NewFlagSet("cherry-pick", 0)
+  cont := flags.Bool("continue", false, "continue")
+  skip := flags.Bool("skip", false, "skip")
+  abort := flags.Bool("abort", false, "abort")
+  flags.Parse(os.Args[2:])
+
+  if *cont || *skip || *abort {
+    seq := loadSequencerOrExit("cherry-pick")
+    switch {
+    case *abort:
+      abortSequencer(seq)
+    case *skip:
+      skipSequencer(seq)
+    default:
+      continueSequencer(seq)
+    }
+    return nil
+  }
+  if flags.NArg() == 0 {
+    UsageCherryPick()
+  }
+  ensureNoSequencer()
+  head, err := core.GetHeadHash()
+  if err != nil {
+    PrintAndExit("Can't cherry-pick, there's no commit yet.")
+  }
+
+  seq := &core.Sequencer{Command : "cherry-pick", OrigHead : head}
+  for _, rev := range(flags.Args()) {
+    hashs := make([][]byte, 0)
+    if core.IsRevisionRange(rev) {
+      var err error
+      if hashs, err = core.ResolveRevisionRange(rev); err != nil {
+        PrintAndExit(revisionErrorString(rev, err))
+      }
+    } else {
+      _, hash := ResolveCommitOrExit(rev)
+      hashs = append(hashs, hash)
+    }
+    // Picks the commits oldest first.
+    for i := len(hashs) - 1; i >= 0; i-- {
+      commit, _ := core.GetCommitObject(hashs[i])
+      seq.Todo = append(seq.Todo, core.TodoItem{
+        Action : core.TodoPick,
+        Hash : hashs[i],
+        Subject : core.FirstLine(commit.Comment),
+      })
+    }
+  }
+  if len(seq.Todo) == 0 {
+    PrintAndExit("There's no commit to cherry-pick.")
+  }
+  ensureNoLocalChanges("cherry-pick")
+  runSequencer(seq)
+  return nil
+}
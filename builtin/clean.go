@@ -0,0 +1,157 @@
+package builtin
+
+import (
+  "flag"
+  "fmt"
+  "github.com/easonliao/flea/core"
+  "os"
+  "path/filepath"
+  "sort"
+)
+
+func UsageClean() {
+  usage :=
+  `Usage: flea clean [-n] [-f] [-d] [-x] [-- <pathspec>...]
+
+  Removes the untracked files matching the pathspec, which is current directory by
+  default. Files ignored by .fleaignore are kept unless -x is given. Either -n or -f is
+  required unless clean.requireForce is set to false.
+
+  -n: Don't remove anything, only show what would be removed.
+  -f: Remove the files.
+  -d: Also remove untracked directories. Without it untracked directories are only looked
+      into when the pathspec selects paths under them.
+  -x: Also remove the ignored files.
+  `
+  fmt.Println(usage)
+  os.Exit(1)
+}
+
+type cleanOptions struct {
+  dryRun bool
+  dirs bool
+}
+
+func CmdClean() error {
+  flags := flag.NewFlagSet("clean", 0)
+  opts := cleanOptions{}
+  flags.BoolVar(&opts.dryRun, "n", false, "dry run")
+  force := flags.Bool("f", false, "force")
+  flags.BoolVar(&opts.dirs, "d", false, "directories")
+  ignored := flags.Bool("x", false, "ignored files")
+  args, paths, _ := splitDashDash(os.Args[2:])
+  flags.Parse(args)
+  paths = append(flags.Args(), paths...)
+  requireForce, err := core.GetConfig().GetBool("clean.requireforce", true)
+  if err != nil {
+    return err
+  }
+  if requireForce && !*force && !opts.dryRun {
+    PrintAndExit("clean.requireForce is true and neither -n nor -f is given, refusing to clean.")
+  }
+  ps := ParsePathspecOrExit(paths)
+  fsTree := core.GetFsTree()
+  if *ignored {
+    fsTree = fsTree.IncludeIgnored()
+  }
+  _, untracked, _ := core.CompareTrees(core.GetIndexTree(), fsTree)
+  sort.Strings(untracked)
+  for _, treePath := range(untracked) {
+    node, err := fsTree.Get(treePath)
+    if err != nil {
+      continue
+    }
+    if !node.IsDir() {
+      if ps.Match(treePath) {
+        cleanPath(treePath, opts)
+      }
+      continue
+    }
+    if !ps.MayMatchUnder(treePath) {
+      continue
+    }
+    if _, err := os.Lstat(filepath.Join(treePathToFsPath(treePath), ".flea")); err == nil {
+      // Nested repositories are never removed.
+      fmt.Printf("Skipping repository %s/\n", TreePathToRelFsPath(treePath))
+      continue
+    }
+    if ps.Match(treePath) {
+      if opts.dirs {
+        cleanDir(fsTree, treePath, opts)
+      }
+      continue
+    }
+    // Only the files selected by the pathspec under the directory.
+    files := make([]string, 0)
+    fsTree.Traverse(func(file string, node core.Node) error {
+      if !node.IsDir() && ps.Match(file) {
+        files = append(files, file)
+      }
+      return nil
+    }, treePath)
+    sort.Strings(files)
+    for _, file := range(files) {
+      cleanPath(file, opts)
+    }
+  }
+  return nil
+}
+
+// Removes the directory with all the files in it. If it has ignored paths which are kept,
+// only the untracked files in it are removed and reported, otherwise the directory is
+// reported as a whole.
+func cleanDir(tree *core.FsTree, dir string, opts cleanOptions) {
+  paths := treePaths(tree, dir)
+  if len(paths) != len(treePaths(tree.IncludeIgnored(), dir)) {
+    for _, treePath := range(paths) {
+      if node, err := tree.Get(treePath); err == nil && !node.IsDir() {
+        cleanPath(treePath, opts)
+      }
+    }
+    if !opts.dryRun {
+      // The directories which become empty.
+      for i := len(paths) - 1; i >= 0; i-- {
+        os.Remove(treePathToFsPath(paths[i]))
+      }
+    }
+    return
+  }
+  fmt.Printf("%s %s/\n", cleanVerb(opts), TreePathToRelFsPath(dir))
+  if opts.dryRun {
+    return
+  }
+  // Deletes in reverse order so files go before their directories.
+  for i := len(paths) - 1; i >= 0; i-- {
+    if err := os.Remove(treePathToFsPath(paths[i])); err != nil {
+      fmt.Println("warning:", err.Error())
+    }
+  }
+}
+
+// Gets the sorted paths of the tree under the directory, including itself.
+func treePaths(tree core.Tree, dir string) []string {
+  paths := make([]string, 0)
+  tree.Traverse(func(treePath string, node core.Node) error {
+    paths = append(paths, treePath)
+    return nil
+  }, dir)
+  sort.Strings(paths)
+  return paths
+}
+
+func cleanPath(treePath string, opts cleanOptions) {
+  fmt.Printf("%s %s\n", cleanVerb(opts), TreePathToRelFsPath(treePath))
+  if !opts.dryRun {
+    if err := os.Remove(treePathToFsPath(treePath)); err != nil {
+      fmt.Println("warning:", err.Error())
+    }
+  }
+}
+
+func cleanVerb(opts cleanOptions) string {
+  if opts.dryRun {
+    return "Would remove"
+  }
+  return "Removing"
+}
+
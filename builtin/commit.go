@@ -6,17 +6,18 @@ import (
   "fmt"
   "github.com/easonliao/flea/core"
   "os"
-  "os/user"
   "sort"
 )
 
 func UsageCommit() {
   usage :=
-  `Usage: flea commit [-a] [-m <msg>]
+  `Usage: flea commit [-a] [-m <msg>] [--author <author>] [--date <date>]
 
   -a: Tell the command to automatically stage files that have been modified and deleted,
       but new files you have not told Flea  about are not affected.
   -m: Use the given <msg> as the commit message.
+  --author: Override the commit author, in the form of "Name <email>".
+  --date: Override the author date used in the commit.
   `
   fmt.Println(usage)
   os.Exit(1)
@@ -30,15 +31,41 @@ func CmdCommit() error {
   flags := flag.NewFlagSet("commit", 0)
   comment := flags.String("m", "No Comment", "comment")
   all := flags.Bool("a", false, "all")
+  authorOpt := flags.String("author", "", "author")
+  dateOpt := flags.String("date", "", "author date")
   flags.Parse(os.Args[2:])
 
-  branch, err := core.GetCurrentBranch()
-  if err == core.ErrNotBranch {
+  author, err := core.GetAuthorIdent()
+  if err != nil {
+    PrintAndExit("Invalid author date: " + err.Error())
+  }
+  committer, err := core.GetCommitterIdent()
+  if err != nil {
+    PrintAndExit("Invalid committer date: " + err.Error())
+  }
+  if *authorOpt != "" {
+    sig, err := core.ParseIdent(*authorOpt)
+    if err != nil {
+      PrintAndExit("Invalid --author: " + err.Error())
+    }
+    author.Name, author.Email = sig.Name, sig.Email
+  }
+  if *dateOpt != "" {
+    if author.When, err = core.ParseDate(*dateOpt); err != nil {
+      PrintAndExit("Invalid --date: " + err.Error())
+    }
+  }
+
+  if _, err := core.GetCurrentBranch(); err == core.ErrNotBranch {
     // We're in non-branch, can't commit anything.
     fmt.Println("Can't commit in a non-branch.")
     os.Exit(1)
   }
 
+  if len(core.ReadConflicts()) > 0 {
+    PrintAndExit("Can't commit, you have unresolved conflicts. Mark them with \"flea add <path>\".")
+  }
+
   indexTree := core.GetIndexTree()
 
   if *all {
@@ -53,8 +80,9 @@ func CmdCommit() error {
         // The file has been deleted.
         deletedPaths = append(deletedPaths, treePath)
       } else if !node.IsDir() {
-        if bytes.Compare(node.GetHashValue(), peerNode.GetHashValue()) != 0 {
-          // The file has been modified.
+        if bytes.Compare(node.GetHashValue(), peerNode.GetHashValue()) != 0 ||
+           node.GetMode() != peerNode.GetMode() {
+          // The file has been modified, or only its mode has been changed.
           modifiedMap[treePath] = peerNode.GetHashValue()
         }
       }
@@ -73,7 +101,8 @@ func CmdCommit() error {
       if bytes.Compare(retHash, hash) != 0 {
         panic("The hashs don't match")
       }
-      if err := indexTree.MkFile(treePath, hash); err != nil {
+      node, _ := fsTree.Get(treePath)
+      if err := indexTree.MkFileAllMode(treePath, hash, node.GetMode()); err != nil {
         panic(err.Error())
       }
     }
@@ -94,39 +123,39 @@ func CmdCommit() error {
     }
   }
 
+  if _, err := commitIndex(author, committer, *comment, "commit"); err != nil {
+    fmt.Printf("Failed to create the commit object: %s\n", err.Error())
+    os.Exit(1)
+  }
+  return nil
+}
+
+// Creates a commit from the staging area on top of HEAD and moves HEAD to it. The update
+// of HEAD is recorded in reflog as "<action>: <subject of message>". If there's no commit
+// yet, the default branch is created.
+func commitIndex(author, committer core.Signature, message, action string) ([]byte, error) {
   // Creats a CATree from staging area.
   caTree, err := core.BuildCATreeFromIndexFile()
   if err != nil {
-    fmt.Printf("Failed to build CATree from staging area: %s\n", err.Error())
-    os.Exit(1)
+    return nil, err
   }
-
   // Hash of current commit, or nil if there's no commit in history of current branch.
-  var commitHash []byte = nil
-  if commit != nil {
-    commitHash = commit.GetCommitHash()
-  }
-
-  var username string = "unknown"
-  if user, err := user.Current(); err == nil {
-    username = user.Username
+  prevHash, err := core.GetHeadHash()
+  if err != nil && err != core.ErrNoHeadFile {
+    return nil, err
   }
   // Creates a commit object.
-  hash, err := core.CreateCommitObject(caTree.GetHash(), commitHash, username, *comment)
-
+  hash, err := core.CreateCommitObject(caTree.GetHash(), prevHash, author, committer, message)
   if err != nil {
-    fmt.Printf("Failed to create the commit object: %s", err.Error())
-    os.Exit(1)
+    return nil, err
   }
-
-  if _, err := core.GetCurrentBranch(); err == nil {
-    // We are in a valid branch, just update the HEAD of the branch.
-    core.UpdateBranchHead(branch, hash)
-  } else if err == core.ErrNoHeadFile {
-    // There's no history and branch. Creates a default master branch and updates its HEAD.
-    core.WriteHeadFile([]byte("ref:master"))
-    branch = "master"
-    core.UpdateBranchHead(branch, hash)
+  if prevHash == nil {
+    // There's no history and branch. Creates the default branch and updates its HEAD.
+    branch := core.GetDefaultBranch()
+    core.WriteHeadFile([]byte("ref:" + branch), "")
+    core.UpdateBranchHead(branch, hash, action + " (initial): " + core.FirstLine(message))
+  } else {
+    core.UpdateHead(hash, action + ": " + core.FirstLine(message))
   }
-  return nil
+  return hash, nil
 }
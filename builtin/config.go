@@ -0,0 +1,103 @@
+package builtin
+
+import (
+  "flag"
+  "fmt"
+  "github.com/easonliao/flea/core"
+  "os"
+)
+
+func UsageConfig() {
+  usage :=
+  `Usage: flea config [--system|--global|--local] get <name>
+       flea config [--system|--global|--local] set <name> <value>
+       flea config [--system|--global|--local] unset <name>
+       flea config [--system|--global|--local] --list
+
+  --system: Use the system-wide config file.
+  --global: Use the per-user config file ~/.fleaconfig.
+  --local: Use the config file of the repository .flea/config. This is the default for
+           set and unset, get and --list read the merged config of all the files unless
+           a file is specified.
+  --list: List all the variables set in config files.
+  `
+  fmt.Println(usage)
+  os.Exit(1)
+}
+
+func CmdConfig() error {
+  flags := flag.NewFlagSet("config", 0)
+  system := flags.Bool("system", false, "system config")
+  global := flags.Bool("global", false, "global config")
+  local := flags.Bool("local", false, "local config")
+  list := flags.Bool("list", false, "list")
+  listShort := flags.Bool("l", false, "list")
+  flags.Parse(os.Args[2:])
+
+  // The config command can run outside of a repository with --system or --global.
+  inRepo := core.InitFromExisting() == nil
+  scope, scoped := core.ConfigLocal, false
+  switch {
+  case *system:
+    scope, scoped = core.ConfigSystem, true
+  case *global:
+    scope, scoped = core.ConfigGlobal, true
+  case *local:
+    scoped = true
+  }
+  if scope == core.ConfigLocal && !inRepo && (scoped || (!*list && !*listShort)) {
+    PrintAndExit("Not a flea repository(or any of the parent directories):.flea")
+  }
+
+  cfg := core.GetConfig()
+  args := flags.Args()
+  if *list || *listShort {
+    for _, entry := range(cfg.List()) {
+      if !scoped || entry.Scope == scope {
+        fmt.Printf("%s=%s\n", entry.Key, entry.Value)
+      }
+    }
+    return nil
+  }
+  if len(args) == 0 {
+    UsageConfig()
+  }
+  switch args[0] {
+  case "get":
+    if len(args) != 2 {
+      UsageConfig()
+    }
+    var value string
+    var ok bool
+    if scoped {
+      file, err := core.LoadConfigFile(core.GetConfigPath(scope))
+      if err != nil {
+        return err
+      }
+      value, ok = file.Get(args[1])
+    } else {
+      value, ok = cfg.Get(args[1])
+    }
+    if !ok {
+      os.Exit(1)
+    }
+    fmt.Println(value)
+  case "set":
+    if len(args) != 3 {
+      UsageConfig()
+    }
+    return cfg.Set(scope, args[1], args[2])
+  case "unset":
+    if len(args) != 2 {
+      UsageConfig()
+    }
+    if err := cfg.Unset(scope, args[1]); err == core.ErrConfigKeyNotFound {
+      os.Exit(1)
+    } else {
+      return err
+    }
+  default:
+    UsageConfig()
+  }
+  return nil
+}
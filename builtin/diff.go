@@ -0,0 +1,201 @@
+package builtin
+
+import (
+  "bytes"
+  "flag"
+  "fmt"
+  "github.com/easonliao/flea/core"
+  "os"
+  "sort"
+  "strings"
+)
+
+func UsageDiff() {
+  usage :=
+  `Usage: flea diff [--cached] [<revision>] [--] [<pathspec>...]
+       flea diff <revision> <revision> [--] [<pathspec>...]
+
+  Shows the changes between the index and working directory, or:
+
+  --cached: the changes between <revision> (HEAD by default) and the index.
+  <revision>: the changes between <revision> and working directory.
+  <revision> <revision>: the changes between the two revisions.
+  `
+  fmt.Println(usage)
+  os.Exit(1)
+}
+
+func CmdDiff() error {
+  args, paths, dashDash := splitDashDash(os.Args[2:])
+  flags := flag.NewFlagSet("diff", 0)
+  cached := flags.Bool("cached", false, "cached")
+  flags.Parse(args)
+  args = flags.Args()
+  if !dashDash {
+    // Without "--" the arguments are revisions until the first one which is not.
+    revs := 0
+    for revs < len(args) && revs < 2 {
+      if _, _, err := core.ResolveCommit(args[revs]); err != nil {
+        break
+      }
+      revs++
+    }
+    args, paths = args[:revs], args[revs:]
+  }
+  if len(args) > 2 || (*cached && len(args) > 1) {
+    UsageDiff()
+  }
+  ps := ParsePathspecOrExit(paths)
+
+  idxTree := core.GetIndexTree()
+  var a, b map[string]core.Node
+  switch {
+  case len(args) == 2:
+    commitA, _ := ResolveCommitOrExit(args[0])
+    commitB, _ := ResolveCommitOrExit(args[1])
+    a, b = treeFiles(commitA.GetCATree(), ps), treeFiles(commitB.GetCATree(), ps)
+  case *cached:
+    rev := "HEAD"
+    if len(args) == 1 {
+      rev = args[0]
+    }
+    var tree core.Tree = core.NewMemTree()
+    if _, err := core.GetHeadHash(); err == nil || rev != "HEAD" {
+      commit, _ := ResolveCommitOrExit(rev)
+      tree = commit.GetCATree()
+    }
+    a, b = treeFiles(tree, ps), treeFiles(idxTree, ps)
+  case len(args) == 1:
+    commit, _ := ResolveCommitOrExit(args[0])
+    a = treeFiles(commit.GetCATree(), ps)
+    // The files tracked by either the revision or the index.
+    tracked := treeFiles(idxTree, ps)
+    for treePath, node := range(a) {
+      tracked[treePath] = node
+    }
+    b = workTreeFiles(tracked)
+  default:
+    a = treeFiles(idxTree, ps)
+    b = workTreeFiles(a)
+  }
+  printDiff(a, b)
+  return nil
+}
+
+// Gets the files of the tree selected by the pathspec, mapping from path to node.
+func treeFiles(tree core.Tree, ps *core.Pathspec) map[string]core.Node {
+  files := make(map[string]core.Node)
+  for _, treePath := range(ps.MatchFiles(tree)) {
+    files[treePath], _ = tree.Get(treePath)
+  }
+  return files
+}
+
+// Gets the nodes in working directory of the tracked files, the files which have been
+// deleted are left out.
+func workTreeFiles(tracked map[string]core.Node) map[string]core.Node {
+  fsTree := core.GetFsTree()
+  files := make(map[string]core.Node)
+  for treePath, _ := range(tracked) {
+    if node, err := fsTree.Get(treePath); err == nil && !node.IsDir() {
+      files[treePath] = node
+    }
+  }
+  return files
+}
+
+// Prints the differences from files a to files b in unified diff format.
+func printDiff(a, b map[string]core.Node) {
+  paths := make([]string, 0, len(a) + len(b))
+  for treePath, _ := range(a) {
+    paths = append(paths, treePath)
+  }
+  for treePath, _ := range(b) {
+    if _, ok := a[treePath]; !ok {
+      paths = append(paths, treePath)
+    }
+  }
+  sort.Strings(paths)
+  for _, treePath := range(paths) {
+    nodeA, nodeB := a[treePath], b[treePath]
+    if nodeA != nil && nodeB != nil && nodeA.GetMode() == nodeB.GetMode() &&
+       bytes.Equal(nodeA.GetHashValue(), nodeB.GetHashValue()) {
+      continue
+    }
+    fmt.Print(formatFileDiff(treePath[1:], nodeA, nodeB))
+  }
+}
+
+// Formats the difference of a file in unified diff format, nil node means the file
+// doesn't exist on that side.
+func formatFileDiff(name string, nodeA, nodeB core.Node) string {
+  var buf bytes.Buffer
+  var dataA, dataB []byte
+  fromName, toName := "a/" + name, "b/" + name
+  fmt.Fprintf(&buf, "diff --flea %s %s\n", fromName, toName)
+  if nodeA == nil {
+    fmt.Fprintf(&buf, "new file mode %s\n", nodeB.GetMode())
+    fromName = "/dev/null"
+  } else {
+    dataA, _ = readNodeData(nodeA)
+  }
+  if nodeB == nil {
+    fmt.Fprintf(&buf, "deleted file mode %s\n", nodeA.GetMode())
+    toName = "/dev/null"
+  } else {
+    dataB, _ = readNodeData(nodeB)
+  }
+  if nodeA != nil && nodeB != nil {
+    if nodeA.GetMode() != nodeB.GetMode() {
+      fmt.Fprintf(&buf, "old mode %s\nnew mode %s\n", nodeA.GetMode(), nodeB.GetMode())
+    }
+    if bytes.Equal(nodeA.GetHashValue(), nodeB.GetHashValue()) {
+      // Only the mode is changed.
+      return buf.String()
+    }
+  }
+  if core.IsBinary(dataA) || core.IsBinary(dataB) {
+    fmt.Fprintf(&buf, "Binary files %s and %s differ\n", fromName, toName)
+    return buf.String()
+  }
+  fmt.Fprintf(&buf, "--- %s\n+++ %s\n", fromName, toName)
+  ops := core.DiffLines(core.SplitLines(dataA), core.SplitLines(dataB))
+  for _, hunk := range(core.GetHunks(ops, 3)) {
+    buf.WriteString(formatHunk(hunk))
+  }
+  return buf.String()
+}
+
+// Formats the hunk with the header "@@ -<start>,<len> +<start>,<len> @@".
+func formatHunk(hunk core.Hunk) string {
+  var buf bytes.Buffer
+  fmt.Fprintf(&buf, "@@ -%s +%s @@\n", formatHunkRange(hunk.AStart, hunk.ALen),
+              formatHunkRange(hunk.BStart, hunk.BLen))
+  for _, op := range(hunk.Ops) {
+    switch op.Kind {
+    case core.DiffEqual:
+      buf.WriteString(" ")
+    case core.DiffInsert:
+      buf.WriteString("+")
+    case core.DiffDelete:
+      buf.WriteString("-")
+    }
+    buf.WriteString(op.Text)
+    if !strings.HasSuffix(op.Text, "\n") {
+      buf.WriteString("\n\\ No newline at end of file\n")
+    }
+  }
+  return buf.String()
+}
+
+// Formats the range of lines, start is 0-based. An empty range refers to the line
+// before it.
+func formatHunkRange(start, length int) string {
+  if length == 1 {
+    return fmt.Sprintf("%d", start + 1)
+  }
+  if length == 0 {
+    return fmt.Sprintf("%d,0", start)
+  }
+  return fmt.Sprintf("%d,%d", start + 1, length)
+}
@@ -0,0 +1,63 @@
+package builtin
+
+import (
+  "github.com/easonliao/flea/core"
+  "io/ioutil"
+  "os"
+  "os/exec"
+  "path/filepath"
+  "strings"
+)
+
+// Gets the editor to edit messages with, in the order of FLEA_EDITOR, core.editor in
+// config, VISUAL and EDITOR. vi is used if none of them is set.
+func getEditor() string {
+  if editor := os.Getenv("FLEA_EDITOR"); editor != "" {
+    return editor
+  }
+  if editor := core.GetConfig().GetString("core.editor", ""); editor != "" {
+    return editor
+  }
+  for _, env := range([]string{"VISUAL", "EDITOR"}) {
+    if editor := os.Getenv(env); editor != "" {
+      return editor
+    }
+  }
+  return "vi"
+}
+
+// Opens the file in the editor and waits for it to exit. The editor is run by shell so
+// it can have arguments.
+func launchEditor(fileName string) error {
+  cmd := exec.Command("sh", "-c", getEditor() + " \"$@\"", getEditor(), fileName)
+  cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+  return cmd.Run()
+}
+
+// Lets users edit the message in the editor, the file is kept in .flea directory with the
+// name. The help is appended as comments, lines starting with "#" are removed from the
+// edited message.
+func editMessage(message, name, help string) (string, error) {
+  fileName := filepath.Join(core.GetFleaDirectory(), name)
+  content := strings.TrimRight(message, "\n") + "\n"
+  if help != "" {
+    content += "\n# " + strings.Replace(strings.TrimRight(help, "\n"), "\n", "\n# ", -1) + "\n"
+  }
+  if err := ioutil.WriteFile(fileName, []byte(content), 0666); err != nil {
+    return "", err
+  }
+  if err := launchEditor(fileName); err != nil {
+    return "", err
+  }
+  data, err := ioutil.ReadFile(fileName)
+  if err != nil {
+    return "", err
+  }
+  lines := make([]string, 0)
+  for _, line := range(strings.Split(string(data), "\n")) {
+    if !strings.HasPrefix(line, "#") {
+      lines = append(lines, line)
+    }
+  }
+  return strings.TrimSpace(strings.Join(lines, "\n")), nil
+}
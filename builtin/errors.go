@@ -5,4 +5,7 @@ import "errors"
 var (
   ErrNotFile = errors.New("builtin: not file")
   ErrEmptyDir = errors.New("builtin: empty directory")
+  ErrUntrackedOverwritten = errors.New("builtin: untracked files would be overwritten")
+  ErrInvalidLineRange = errors.New("builtin: invalid line range")
+  ErrEditedHunk = errors.New("builtin: the edited hunk doesn't apply")
 )
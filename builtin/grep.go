@@ -0,0 +1,162 @@
+package builtin
+
+import (
+  "flag"
+  "fmt"
+  "github.com/easonliao/flea/core"
+  "os"
+  "regexp"
+  "runtime"
+  "sort"
+  "sync"
+)
+
+func UsageGrep() {
+  usage :=
+  `Usage: flea grep [-n] [-i] [-l] [-E] [--cached] <pattern> [<revision>] [-- <pathspec>...]
+
+  Prints the lines matching the pattern in the tracked files of working directory, the
+  index with --cached, or the tree of <revision>. Nothing is checked out for searching.
+
+  -n: Prefix the line number to matching lines.
+  -i: Ignore case differences.
+  -l: Only print the names of the files which have matching lines.
+  -E: The pattern is an extended regular expression rather than a basic one.
+  --cached: Search the files in the index instead of working directory.
+  `
+  fmt.Println(usage)
+  os.Exit(1)
+}
+
+type grepOptions struct {
+  lineNumber bool
+  filesOnly bool
+  // Prefixed to the paths in output, it's the revision and a colon for trees of commits.
+  prefix string
+}
+
+// The result of searching one file.
+type grepResult struct {
+  path string
+  matches []core.GrepMatch
+  binary bool
+  err error
+}
+
+func CmdGrep() error {
+  flags := flag.NewFlagSet("grep", 0)
+  opts := grepOptions{}
+  flags.BoolVar(&opts.lineNumber, "n", false, "line number")
+  ignoreCase := flags.Bool("i", false, "ignore case")
+  flags.BoolVar(&opts.filesOnly, "l", false, "files with matches")
+  extended := flags.Bool("E", false, "extended regexp")
+  cached := flags.Bool("cached", false, "search the index")
+  args, paths, _ := splitDashDash(os.Args[2:])
+  flags.Parse(args)
+  if flags.NArg() == 0 || flags.NArg() > 2 || (*cached && flags.NArg() == 2) {
+    UsageGrep()
+  }
+  re, err := core.CompileGrepPattern(flags.Arg(0), *extended, *ignoreCase)
+  if err != nil {
+    PrintAndExit(fmt.Sprintf("Invalid pattern: %s", err))
+  }
+  ps := ParsePathspecOrExit(paths)
+
+  var files map[string]core.Node
+  idxTree := core.GetIndexTree()
+  if flags.NArg() == 2 {
+    rev := flags.Arg(1)
+    commit, _ := ResolveCommitOrExit(rev)
+    files = treeFiles(commit.GetCATree(), ps)
+    opts.prefix = rev + ":"
+  } else if *cached {
+    files = treeFiles(idxTree, ps)
+  } else {
+    files = workTreeFiles(treeFiles(idxTree, ps))
+  }
+  if !printGrepResults(grepFiles(re, files), opts) {
+    // Like grep, exits with 1 if nothing matches.
+    os.Exit(1)
+  }
+  return nil
+}
+
+// Searches the files in parallel, the results are sorted by path.
+func grepFiles(re *regexp.Regexp, files map[string]core.Node) []grepResult {
+  paths := make([]string, 0, len(files))
+  for treePath, _ := range(files) {
+    paths = append(paths, treePath)
+  }
+  sort.Strings(paths)
+  results := make([]grepResult, len(paths))
+  // Makes sure the store is set up before the workers share it.
+  core.GetCAStore()
+  jobs := make(chan int)
+  var wg sync.WaitGroup
+  for w := 0; w < runtime.NumCPU(); w++ {
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      for i := range(jobs) {
+        results[i] = grepFile(re, paths[i], files[paths[i]])
+      }
+    }()
+  }
+  for i := range(paths) {
+    jobs <- i
+  }
+  close(jobs)
+  wg.Wait()
+  return results
+}
+
+func grepFile(re *regexp.Regexp, treePath string, node core.Node) grepResult {
+  result := grepResult{path : treePath}
+  data, err := readNodeData(node)
+  if err != nil {
+    result.err = err
+    return result
+  }
+  if core.IsBinary(data) {
+    result.binary = re.Match(data)
+    return result
+  }
+  result.matches = core.GrepLines(re, data)
+  return result
+}
+
+// Prints the results, returns whether anything matches.
+func printGrepResults(results []grepResult, opts grepOptions) bool {
+  found := false
+  for _, result := range(results) {
+    name := opts.prefix + TreePathToRelFsPath(result.path)
+    switch {
+    case result.err != nil:
+      fmt.Fprintf(os.Stderr, "warning: failed to read %s: %s\n", name, result.err)
+      continue
+    case result.binary:
+      found = true
+      if opts.filesOnly {
+        fmt.Println(name)
+      } else {
+        fmt.Printf("Binary file %s matches\n", name)
+      }
+      continue
+    case len(result.matches) == 0:
+      continue
+    }
+    found = true
+    if opts.filesOnly {
+      fmt.Println(name)
+      continue
+    }
+    for _, match := range(result.matches) {
+      if opts.lineNumber {
+        fmt.Printf("%s:%d:%s\n", name, match.Line, match.Text)
+      } else {
+        fmt.Printf("%s:%s\n", name, match.Text)
+      }
+    }
+  }
+  return found
+}
@@ -1,30 +1,577 @@
 package builtin
 
 import (
+  "bytes"
+  "flag"
   "fmt"
   "github.com/easonliao/flea/core"
   "os"
+  "regexp"
+  "sort"
+  "strings"
+  "time"
 )
 
 func UsageLog() {
-  fmt.Println("Usage: flea log")
+  usage :=
+  `Usage: flea log [<options>] [<revision>...] [[--] <pathspec>...]
+
+  Shows the commits reachable from the revisions, HEAD by default. A revision can be a
+  range in the form of <rev1>..<rev2>, which shows the commits reachable from <rev2> but
+  not from <rev1>. Only the commits changing the files selected by the pathspec are shown
+  if it's given.
+
+  --oneline: Show each commit in one line with the abbreviated hash and subject.
+  -n <N>: Show at most N commits.
+  --since <date>, --until <date>: Show the commits committed after/before the date,
+                                  e.g. "2020-01-02" or "2 weeks ago".
+  --author <regexp>: Show the commits whose author matches "Name <email>".
+  --grep <regexp>: Show the commits whose message matches.
+  --format <format>: Show each commit with the format, which can contain:
+                     %H, %h: hash, abbreviated hash
+                     %T, %t: tree hash, abbreviated tree hash
+                     %P, %p: parent hash, abbreviated parent hash
+                     %an, %ae, %ad: author name, email and date
+                     %cn, %ce, %cd: committer name, email and date
+                     %s, %b: subject and body of the message
+                     %n, %%: newline and "%"
+  --graph: Draw the history graph on the left side of the commits.
+  --stat: Show the number of lines changed by each commit per file.
+  --name-status: Show the files changed by each commit and how they were changed.
+  `
+  fmt.Println(usage)
   os.Exit(1)
 }
 
 func CmdLog() error {
-  commit, err := core.GetCurrentCommit()
-  if err == nil {
-    for commit != nil {
-      printCommit(commit)
-      commit = commit.GetPrevCommit()
+  args, paths, dashDash := splitDashDash(os.Args[2:])
+  flags := flag.NewFlagSet("log", 0)
+  oneline := flags.Bool("oneline", false, "oneline")
+  maxCount := flags.Int("n", -1, "max count")
+  since := flags.String("since", "", "since")
+  until := flags.String("until", "", "until")
+  author := flags.String("author", "", "author")
+  grep := flags.String("grep", "", "grep")
+  format := flags.String("format", "", "format")
+  graph := flags.Bool("graph", false, "graph")
+  stat := flags.Bool("stat", false, "stat")
+  nameStatus := flags.Bool("name-status", false, "name status")
+  flags.Usage = UsageLog
+  flags.Parse(args)
+  args = flags.Args()
+  if !dashDash {
+    // Without "--" the arguments are revisions until the first one which is not.
+    revs := 0
+    for revs < len(args) && isRevisionArg(args[revs]) {
+      revs++
+    }
+    args, paths = args[:revs], args[revs:]
+    for _, arg := range(paths) {
+      ensurePathArg(arg)
+    }
+  }
+
+  filter := &logFilter{}
+  if len(paths) > 0 {
+    filter.pathspec = ParsePathspecOrExit(paths)
+  }
+  if *since != "" {
+    filter.since = parseDateOrExit(*since)
+  }
+  if *until != "" {
+    filter.until = parseDateOrExit(*until)
+  }
+  if *author != "" {
+    filter.author = compileOrExit(*author)
+  }
+  if *grep != "" {
+    filter.grep = compileOrExit(*grep)
+  }
+
+  include, exclude := make([][]byte, 0), make([][]byte, 0)
+  for _, rev := range(args) {
+    if core.IsRevisionRange(rev) {
+      idx := strings.Index(rev, "..")
+      include = append(include, resolveRangeSideOrExit(rev[idx + 2:]))
+      exclude = append(exclude, resolveRangeSideOrExit(rev[:idx]))
+    } else {
+      _, hash := ResolveCommitOrExit(rev)
+      include = append(include, hash)
+    }
+  }
+  if len(args) == 0 {
+    head, err := core.GetHeadHash()
+    if err != nil {
+      // The history is empty.
+      return err
+    }
+    include = append(include, head)
+  }
+  hashs, err := core.WalkCommits(include, exclude)
+  if err != nil {
+    PrintAndExit(err.Error())
+  }
+
+  if *oneline && *format == "" {
+    *format = "%h %s"
+  }
+  var lanes *graphLanes
+  if *graph {
+    lanes = &graphLanes{}
+  }
+  shown := 0
+  for _, hash := range(hashs) {
+    if *maxCount >= 0 && shown >= *maxCount {
+      break
+    }
+    commit, _ := core.GetCommitObject(hash)
+    // Listing the changes needs both trees, it's only done when they're used.
+    var changes []fileChange
+    if filter.pathspec != nil || *stat || *nameStatus {
+      var parent *core.Commit
+      if commit.PrevCommit != nil {
+        parent, _ = core.GetCommitObject(commit.PrevCommit)
+      }
+      changes = commitChanges(commit, parent, filter.pathspec)
+    }
+    if !filter.match(commit, changes) {
+      if lanes != nil {
+        lanes.skip(hash, commit.PrevCommit)
+      }
+      continue
+    }
+    shown++
+    var buf bytes.Buffer
+    if *format != "" {
+      buf.WriteString(formatCommit(*format, commit, hash) + "\n")
+    } else {
+      buf.WriteString(formatCommitMedium(commit, hash))
+    }
+    if *stat {
+      buf.WriteString(formatStat(changes))
+    }
+    if *nameStatus {
+      for _, change := range(changes) {
+        fmt.Fprintf(&buf, "%c\t%s\n", change.Status, change.Path[1:])
+      }
+    }
+    if (*stat || *nameStatus) && *format != "" {
+      buf.WriteString("\n")
+    }
+    if lanes != nil {
+      fmt.Print(lanes.draw(hash, commit.PrevCommit, buf.String()))
+    } else {
+      fmt.Print(buf.String())
+    }
+  }
+  return nil
+}
+
+// Checks whether the argument is a revision or a range of revisions.
+func isRevisionArg(arg string) bool {
+  if core.IsRevisionRange(arg) {
+    // Both sides must resolve, so paths like "../a" are not taken as ranges.
+    idx := strings.Index(arg, "..")
+    return isRangeSide(arg[:idx]) && isRangeSide(arg[idx + 2:])
+  }
+  _, _, err := core.ResolveCommit(arg)
+  return err == nil
+}
+
+func isRangeSide(rev string) bool {
+  if rev == "" {
+    return true
+  }
+  _, _, err := core.ResolveCommit(rev)
+  return err == nil
+}
+
+// Exits if the argument taken as a path without "--" is neither a revision nor a path in
+// the index or working directory, it's likely a misspelled revision. Globs are allowed.
+func ensurePathArg(arg string) {
+  if strings.ContainsAny(arg, "*?[") || strings.HasPrefix(arg, ":") {
+    return
+  }
+  treePath := argToTreePath(arg)
+  if _, err := core.GetIndexTree().Get(treePath); err == nil {
+    return
+  }
+  if _, err := os.Lstat(treePathToFsPath(treePath)); err == nil {
+    return
+  }
+  PrintAndExit(fmt.Sprintf("Ambiguous argument '%s': unknown revision or path not in the " +
+                           "working tree.\nUse '--' to separate paths from revisions.", arg))
+}
+
+// Resolves a side of the range, an empty side means HEAD.
+func resolveRangeSideOrExit(rev string) []byte {
+  if rev == "" {
+    rev = "HEAD"
+  }
+  _, hash := ResolveCommitOrExit(rev)
+  return hash
+}
+
+func parseDateOrExit(date string) time.Time {
+  t, err := core.ParseDate(date)
+  if err != nil {
+    PrintAndExit(fmt.Sprintf("Invalid date: %s", date))
+  }
+  return t
+}
+
+func compileOrExit(expr string) *regexp.Regexp {
+  re, err := regexp.Compile(expr)
+  if err != nil {
+    PrintAndExit(fmt.Sprintf("Invalid regular expression: %s", expr))
+  }
+  return re
+}
+
+// The conditions of the commits to show, the zero values match everything.
+type logFilter struct {
+  pathspec *core.Pathspec
+  since time.Time
+  until time.Time
+  author *regexp.Regexp
+  grep *regexp.Regexp
+}
+
+// Checks whether the commit should be shown, changes are the changes of the commit to the
+// files selected by the pathspec, they're only used if there's a pathspec.
+func (filter *logFilter) match(commit *core.Commit, changes []fileChange) bool {
+  when := commit.GetCommitter().When
+  switch {
+  case filter.pathspec != nil && len(changes) == 0:
+    return false
+  case !filter.since.IsZero() && when.Before(filter.since):
+    return false
+  case !filter.until.IsZero() && when.After(filter.until):
+    return false
+  case filter.author != nil && !filter.author.MatchString(commit.GetAuthor().String()):
+    return false
+  case filter.grep != nil && !filter.grep.MatchString(commit.Comment):
+    return false
+  }
+  return true
+}
+
+// A file changed by a commit, Status is 'A' for added, 'D' for deleted and 'M' for
+// modified files. Old and New are nil if the file doesn't exist on that side.
+type fileChange struct {
+  Path string
+  Status byte
+  Old core.Node
+  New core.Node
+}
+
+// Gets the changes of the commit to the files selected by the pathspec, compared to its
+// parent which is nil for the root commit. All the files are selected if the pathspec
+// is nil. The changes are sorted by path.
+func commitChanges(commit, parent *core.Commit, ps *core.Pathspec) []fileChange {
+  if ps == nil {
+    ps = ParsePathspecOrExit(nil)
+  }
+  var parentTree core.Tree = core.NewMemTree()
+  if parent != nil {
+    parentTree = parent.GetCATree()
+  }
+  a, b := treeFiles(parentTree, ps), treeFiles(commit.GetCATree(), ps)
+  changes := make([]fileChange, 0)
+  for treePath, node := range(a) {
+    if peer, ok := b[treePath]; !ok {
+      changes = append(changes, fileChange{treePath, 'D', node, nil})
+    } else if !bytes.Equal(node.GetHashValue(), peer.GetHashValue()) ||
+              node.GetMode() != peer.GetMode() {
+      changes = append(changes, fileChange{treePath, 'M', node, peer})
+    }
+  }
+  for treePath, node := range(b) {
+    if _, ok := a[treePath]; !ok {
+      changes = append(changes, fileChange{treePath, 'A', nil, node})
     }
   }
-  return err
+  sort.Slice(changes, func(i, j int) bool {
+    return changes[i].Path < changes[j].Path
+  })
+  return changes
+}
+
+// Formats the changes in the way of " <path> | <count> ++--", followed by a summary.
+func formatStat(changes []fileChange) string {
+  type fileStat struct {
+    name string
+    insertions int
+    deletions int
+    binary bool
+  }
+  stats := make([]fileStat, 0, len(changes))
+  nameWidth, maxCount, insertions, deletions := 0, 0, 0, 0
+  for _, change := range(changes) {
+    stat := fileStat{name : TreePathToRelFsPath(change.Path)}
+    var dataA, dataB []byte
+    if change.Old != nil {
+      dataA, _ = readNodeData(change.Old)
+    }
+    if change.New != nil {
+      dataB, _ = readNodeData(change.New)
+    }
+    if core.IsBinary(dataA) || core.IsBinary(dataB) {
+      stat.binary = true
+    } else {
+      for _, op := range(core.DiffLines(core.SplitLines(dataA), core.SplitLines(dataB))) {
+        switch op.Kind {
+        case core.DiffInsert:
+          stat.insertions++
+        case core.DiffDelete:
+          stat.deletions++
+        }
+      }
+    }
+    if len(stat.name) > nameWidth {
+      nameWidth = len(stat.name)
+    }
+    if count := stat.insertions + stat.deletions; count > maxCount {
+      maxCount = count
+    }
+    insertions += stat.insertions
+    deletions += stat.deletions
+    stats = append(stats, stat)
+  }
+  if len(stats) == 0 {
+    return ""
+  }
+  // The bars are scaled down if they would be too long.
+  const maxBar = 40
+  scale := func(n int) int {
+    if maxCount <= maxBar || n == 0 {
+      return n
+    }
+    if scaled := n * maxBar / maxCount; scaled > 0 {
+      return scaled
+    }
+    return 1
+  }
+  countWidth := len(fmt.Sprint(maxCount))
+  var buf bytes.Buffer
+  for _, stat := range(stats) {
+    if stat.binary {
+      fmt.Fprintf(&buf, " %-*s | %*s\n", nameWidth, stat.name, countWidth, "Bin")
+      continue
+    }
+    fmt.Fprintf(&buf, " %-*s | %*d %s%s\n", nameWidth, stat.name, countWidth,
+                stat.insertions + stat.deletions, strings.Repeat("+", scale(stat.insertions)),
+                strings.Repeat("-", scale(stat.deletions)))
+  }
+  fmt.Fprintf(&buf, " %s changed", plural(len(stats), "file"))
+  if insertions > 0 {
+    fmt.Fprintf(&buf, ", %s(+)", plural(insertions, "insertion"))
+  }
+  if deletions > 0 {
+    fmt.Fprintf(&buf, ", %s(-)", plural(deletions, "deletion"))
+  }
+  buf.WriteString("\n")
+  return buf.String()
+}
+
+// Formats the count with the noun, e.g. "1 file" and "2 files".
+func plural(n int, noun string) string {
+  if n == 1 {
+    return fmt.Sprintf("%d %s", n, noun)
+  }
+  return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// The pattern of the placeholders in formats of commits.
+var formatPlaceholder = regexp.MustCompile("%(an|ae|ad|cn|ce|cd|[HhTtPpsbn%])")
+
+// Formats the commit with the format, see UsageLog for the placeholders. Unknown
+// placeholders are kept as they are.
+func formatCommit(format string, commit *core.Commit, hash []byte) string {
+  author, committer := commit.GetAuthor(), commit.GetCommitter()
+  subject, body := core.FirstLine(commit.Comment), ""
+  if idx := strings.Index(commit.Comment, "\n"); idx != -1 {
+    body = strings.TrimLeft(commit.Comment[idx + 1:], "\n")
+  }
+  abbrev := func(hash []byte) string {
+    if len(hash) < 4 {
+      return ""
+    }
+    return fmt.Sprintf("%x", hash[:4])
+  }
+  date := func(t time.Time) string {
+    if t.IsZero() {
+      return ""
+    }
+    return formatLogDate(t)
+  }
+  return formatPlaceholder.ReplaceAllStringFunc(format, func(placeholder string) string {
+    switch placeholder[1:] {
+    case "H":
+      return fmt.Sprintf("%x", hash)
+    case "h":
+      return abbrev(hash)
+    case "T":
+      return fmt.Sprintf("%x", commit.Tree)
+    case "t":
+      return abbrev(commit.Tree)
+    case "P":
+      return fmt.Sprintf("%x", commit.PrevCommit)
+    case "p":
+      return abbrev(commit.PrevCommit)
+    case "an":
+      return author.Name
+    case "ae":
+      return author.Email
+    case "ad":
+      return date(author.When)
+    case "cn":
+      return committer.Name
+    case "ce":
+      return committer.Email
+    case "cd":
+      return date(committer.When)
+    case "s":
+      return subject
+    case "b":
+      return body
+    case "n":
+      return "\n"
+    }
+    return "%"
+  })
 }
 
 func printCommit(commit *core.Commit) {
-  fmt.Printf("Commit: %x\n", commit.GetCommitHash())
-  fmt.Printf("Author: %s\n", commit.Author)
-  fmt.Printf("Comment: %s\n", commit.Comment)
-  fmt.Println("")
+  fmt.Print(formatCommitMedium(commit, commit.GetCommitHash()))
+}
+
+// Formats the commit in the default format of log.
+func formatCommitMedium(commit *core.Commit, hash []byte) string {
+  var buf bytes.Buffer
+  author := commit.GetAuthor()
+  committer := commit.GetCommitter()
+  fmt.Fprintf(&buf, "Commit: %x\n", hash)
+  if author.Email != "" {
+    fmt.Fprintf(&buf, "Author: %s\n", author)
+  } else {
+    // Old commits only record the name of the author.
+    fmt.Fprintf(&buf, "Author: %s\n", author.Name)
+  }
+  if !author.When.IsZero() {
+    fmt.Fprintf(&buf, "Date: %s\n", formatLogDate(author.When))
+  }
+  if committer.Name != author.Name || committer.Email != author.Email {
+    fmt.Fprintf(&buf, "Committer: %s\n", committer)
+  }
+  if !committer.When.IsZero() && !committer.When.Equal(author.When) {
+    fmt.Fprintf(&buf, "CommitDate: %s\n", formatLogDate(committer.When))
+  }
+  fmt.Fprintf(&buf, "Comment: %s\n", commit.Comment)
+  buf.WriteString("\n")
+  return buf.String()
+}
+
+// Formats the time in the way of "Mon Jan 2 15:04:05 2006 -0700".
+func formatLogDate(t time.Time) string {
+  return t.Format("Mon Jan 2 15:04:05 2006 -0700")
+}
+
+// The state of the history graph. Each lane is a line of history going down, it holds the
+// hash of the next commit expected on it.
+type graphLanes struct {
+  lanes [][]byte
+}
+
+// Draws the commit with its output. The first line of output is prefixed with "*" in the
+// lane of the commit, other lines are prefixed with the lanes. Lanes which end up waiting
+// for the same commit, i.e. branches forking from it, are merged with "/".
+func (g *graphLanes) draw(hash, parent []byte, output string) string {
+  col := g.lane(hash)
+  var buf bytes.Buffer
+  lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+  buf.WriteString(g.row(col) + lines[0] + "\n")
+  g.advance(col, parent)
+  for _, line := range(lines[1:]) {
+    buf.WriteString(strings.TrimRight(g.row(-1) + line, " ") + "\n")
+  }
+  buf.WriteString(g.collapse())
+  return buf.String()
+}
+
+// Moves the lane of the commit which isn't shown to its parent.
+func (g *graphLanes) skip(hash, parent []byte) {
+  g.advance(g.lane(hash), parent)
+  g.collapse()
+}
+
+// Gets the lane waiting for the commit, a new lane is added if there's none.
+func (g *graphLanes) lane(hash []byte) int {
+  for i, next := range(g.lanes) {
+    if bytes.Equal(next, hash) {
+      return i
+    }
+  }
+  g.lanes = append(g.lanes, hash)
+  return len(g.lanes) - 1
+}
+
+// Makes the lane wait for the parent, the lane ends if there's no parent.
+func (g *graphLanes) advance(col int, parent []byte) {
+  if parent == nil {
+    g.lanes = append(g.lanes[:col], g.lanes[col + 1:]...)
+  } else {
+    g.lanes[col] = parent
+  }
+}
+
+// Gets the prefix of a line, with "*" in the lane of col.
+func (g *graphLanes) row(col int) string {
+  var buf bytes.Buffer
+  for i := range(g.lanes) {
+    if i == col {
+      buf.WriteString("* ")
+    } else {
+      buf.WriteString("| ")
+    }
+  }
+  return buf.String()
+}
+
+// Merges the lanes waiting for the same commit, one line is drawn for each merged lane.
+func (g *graphLanes) collapse() string {
+  var buf bytes.Buffer
+  for {
+    from, to := -1, -1
+    for j := 1; j < len(g.lanes) && from == -1; j++ {
+      for k := 0; k < j; k++ {
+        if bytes.Equal(g.lanes[k], g.lanes[j]) {
+          from, to = j, k
+          break
+        }
+      }
+    }
+    if from == -1 {
+      return buf.String()
+    }
+    // The lane goes left to its target lane, the lanes on the right of it shift left.
+    line := make([]byte, 0, 2 * len(g.lanes))
+    for i := range(g.lanes) {
+      switch {
+      case i < from:
+        line = append(line, '|')
+        if i == from - 1 {
+          line = append(line, '/')
+        } else if i >= to {
+          line = append(line, '_')
+        } else {
+          line = append(line, ' ')
+        }
+      case i > from:
+        line = append(line, ' ', '/')
+      }
+    }
+    buf.WriteString(strings.TrimRight(string(line), " ") + "\n")
+    g.lanes = append(g.lanes[:from], g.lanes[from + 1:]...)
+  }
 }
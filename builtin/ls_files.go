@@ -8,11 +8,12 @@ import (
 )
 
 func UsageLsFiles() {
-  fmt.Println("Usage: flea ls-files")
+  fmt.Println("Usage: flea ls-files [<pathspec>...]")
   os.Exit(1)
 }
 
 func CmdLsFiles() error {
+  ps := ParsePathspecOrExit(os.Args[2:])
   if commit, err := core.GetCurrentCommit(); err == nil {
     tree := commit.GetCATree()
     filepaths := make([]string, 0)
@@ -20,6 +21,12 @@ func CmdLsFiles() error {
       if treePath == "/" {
         return nil
       }
+      if !ps.Match(treePath) {
+        if node.IsDir() && !ps.MayMatchUnder(treePath) {
+          return core.SkipDirNode
+        }
+        return nil
+      }
       filepaths = append(filepaths, treePath)
       return nil
     }
@@ -0,0 +1,242 @@
+package builtin
+
+import (
+  "bytes"
+  "fmt"
+  "github.com/easonliao/flea/core"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "sort"
+)
+
+// Checks whether there are staged changes, or unstaged changes to tracked files.
+// Untracked files are not local changes.
+func hasLocalChanges() bool {
+  if _, err := core.GetHeadHash(); err == nil && hasStagedChanges() {
+    return true
+  }
+  return hasUnstagedChanges()
+}
+
+// Checks whether the tracked files in working directory differ from the index.
+func hasUnstagedChanges() bool {
+  // The working directory may have been changed by the command.
+  core.GetFsTree().ClearCache()
+  deleted, _, diffes := core.CompareTrees(core.GetIndexTree(), core.GetFsTree())
+  return len(deleted) > 0 || len(diffes) > 0
+}
+
+// Checks whether the index differs from HEAD.
+func hasStagedChanges() bool {
+  commit, err := core.GetCurrentCommit()
+  if err != nil {
+    return true
+  }
+  return bytes.Compare(commit.Tree, core.GetIndexTree().GetHash()) != 0
+}
+
+// Exits if there are local changes, the action is used in the message.
+func ensureNoLocalChanges(action string) {
+  if len(core.ReadConflicts()) > 0 {
+    PrintAndExit(fmt.Sprintf("Can't %s, you have unresolved conflicts.", action))
+  }
+  if hasLocalChanges() {
+    PrintAndExit(fmt.Sprintf("Can't %s, you have local changes. Please commit them first.",
+                             action))
+  }
+}
+
+// Merges the changes from base to theirs into HEAD, the result is written to the index
+// and working directory. Conflicted paths keep the version of HEAD in the index and get
+// the conflict content in working directory, they are recorded so they can be resolved
+// by add. Returns the conflicts, nothing is changed if the merge would overwrite untracked
+// files in working directory.
+func mergeIntoWorkTree(base, theirs core.Tree,
+                       labels core.MergeLabels) ([]core.MergeConflict, error) {
+  idxTree := core.GetIndexTree()
+  ours := core.NewMemTree()
+  ours.CopyFrom(idxTree, "/")
+  result, conflicts, err := core.MergeTrees(base, ours, theirs, labels)
+  if err != nil {
+    PrintAndExit("Failed to merge: " + err.Error())
+  }
+  if err := checkUntrackedOverwritten(ours, result); err != nil {
+    return nil, err
+  }
+  updateWorkTree(ours, result)
+  if err := idxTree.CopyFrom(result, "/"); err != nil {
+    PrintAndExit(err.Error())
+  }
+  unmerged := make([]core.UnmergedPath, len(conflicts))
+  for i, conflict := range(conflicts) {
+    unmerged[i] = core.UnmergedPath{Path : conflict.Path, Kind : conflict.Kind}
+    fsPath := filepath.Join(core.GetRepoDirectory(), TreePathToRelFsPath(conflict.Path))
+    os.MkdirAll(filepath.Dir(fsPath), 0777)
+    // The conflict content of symlinks is left as a regular file.
+    mode := core.ModeRegular
+    if node, err := result.Get(conflict.Path); err == nil && node.GetMode() == core.ModeExec {
+      mode = core.ModeExec
+    }
+    writeWorkFile(fsPath, conflict.Content, mode)
+  }
+  core.WriteConflicts(unmerged)
+  return conflicts, nil
+}
+
+// Checks whether updating the working directory from tree from to tree to would overwrite
+// untracked files, the paths are printed if so.
+func checkUntrackedOverwritten(from, to core.Tree) error {
+  _, added, _ := core.CompareTrees(from, to)
+  fsTree := core.GetFsTree()
+  fsTree.ClearCache()
+  overwritten := make([]string, 0)
+  for _, treePath := range(added) {
+    to.Traverse(func(nodePath string, node core.Node) error {
+      if fsNode, err := fsTree.Get(nodePath); err == nil && !fsNode.IsDir() &&
+         (node.IsDir() || !bytes.Equal(fsNode.GetHashValue(), node.GetHashValue())) {
+        overwritten = append(overwritten, nodePath)
+      }
+      return nil
+    }, treePath)
+  }
+  if len(overwritten) == 0 {
+    return nil
+  }
+  fmt.Println("The following untracked files would be overwritten:")
+  for _, treePath := range(overwritten) {
+    fmt.Printf("\t%s\n", TreePathToRelFsPath(treePath))
+  }
+  fmt.Println("Please move or remove them first.")
+  return ErrUntrackedOverwritten
+}
+
+// Prints the conflicts and how to go on.
+func printConflicts(conflicts []core.MergeConflict, command string) {
+  for _, conflict := range(conflicts) {
+    fmt.Printf("CONFLICT (%s): %s\n", conflict.Kind, TreePathToRelFsPath(conflict.Path))
+  }
+  fmt.Println("Resolve the conflicts and mark them with \"flea add <path>\", then run")
+  fmt.Printf("\"flea %s --continue\". Run \"flea %s --abort\" to cancel.\n", command, command)
+}
+
+// Updates the files in working directory which differ between from tree and to tree, so
+// files of from tree become files of to tree. Other files are left alone.
+func updateWorkTree(from, to core.Tree) {
+  deleted, added, diffes := core.CompareTrees(from, to)
+  // Deletes the files/dirs in reverse order of the namespace hierarchy.
+  sort.Sort(sort.Reverse(sort.StringSlice(deleted)))
+  for _, treePath := range(deleted) {
+    node, _ := from.Get(treePath)
+    if node.IsDir() {
+      deleteFilesOfSubtree(from, treePath)
+    } else {
+      os.Remove(filepath.Join(core.GetRepoDirectory(), TreePathToRelFsPath(treePath)))
+    }
+  }
+  for _, treePath := range(append(diffes, added...)) {
+    node, _ := to.Get(treePath)
+    if !node.IsDir() {
+      // A directory may be replaced by a file.
+      os.RemoveAll(filepath.Join(core.GetRepoDirectory(), TreePathToRelFsPath(treePath)))
+    }
+    writeSubtreeToWorkDir(to, treePath)
+  }
+}
+
+// Writes the node of the path in tree and everything under it to working directory.
+func writeSubtreeToWorkDir(tree core.Tree, treePath string) error {
+  writeFn := func(nodePath string, node core.Node) error {
+    fsPath := filepath.Join(core.GetRepoDirectory(), TreePathToRelFsPath(nodePath))
+    if node.IsDir() {
+      return os.MkdirAll(fsPath, 0777)
+    }
+    data, err := core.GetCAStore().GetBlob(node.GetHashValue())
+    if err != nil {
+      return err
+    }
+    os.MkdirAll(filepath.Dir(fsPath), 0777)
+    return writeWorkFile(fsPath, data, node.GetMode())
+  }
+  return tree.Traverse(writeFn, treePath)
+}
+
+// Writes the data to the file in working directory with the permission of the mode. The
+// permission of an existing file is changed too, which WriteFile doesn't do. A symlink is
+// created for ModeSymlink, the data is the target.
+func writeWorkFile(fsPath string, data []byte, mode core.FileMode) error {
+  // Writing to an existing symlink would write to its target, it's replaced instead.
+  if fi, err := os.Lstat(fsPath); err == nil &&
+     (mode == core.ModeSymlink || fi.Mode() & os.ModeSymlink != 0) {
+    os.Remove(fsPath)
+  }
+  if mode == core.ModeSymlink {
+    return os.Symlink(filepath.FromSlash(string(data)), fsPath)
+  }
+  if err := ioutil.WriteFile(fsPath, data, mode.Perm()); err != nil {
+    return err
+  }
+  return os.Chmod(fsPath, mode.Perm())
+}
+
+// Deletes the files of the subtree from working directory, directories which are not
+// empty after that are kept.
+func deleteFilesOfSubtree(tree core.Tree, treePath string) {
+  paths := make([]string, 0)
+  tree.Traverse(func(nodePath string, node core.Node) error {
+    paths = append(paths, nodePath)
+    return nil
+  }, treePath)
+  sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+  for _, p := range(paths) {
+    os.Remove(filepath.Join(core.GetRepoDirectory(), TreePathToRelFsPath(p)))
+  }
+}
+
+// Resets the index and working directory to HEAD, discarding all the changes to tracked
+// files. It's used to abort the commands which stop with conflicts.
+func resetHardToHead() {
+  commit, err := core.GetCurrentCommit()
+  if err != nil {
+    PrintAndExit("There's no commit to reset to.")
+  }
+  idxTree := core.GetIndexTree()
+  ours := core.NewMemTree()
+  ours.CopyFrom(idxTree, "/")
+  head := commit.GetCATree()
+  // Files which have been modified or deleted in working directory are rewritten.
+  fsTree := core.GetFsTree()
+  fsTree.ClearCache()
+  deleted, _, modified := core.CompareTrees(idxTree, fsTree)
+  updateWorkTree(ours, head)
+  for _, treePath := range(append(deleted, modified...)) {
+    if _, err := head.Get(treePath); err == nil {
+      writeSubtreeToWorkDir(head, treePath)
+    } else {
+      os.Remove(filepath.Join(core.GetRepoDirectory(), TreePathToRelFsPath(treePath)))
+    }
+  }
+  idxTree.CopyFrom(head, "/")
+  core.WriteConflicts(nil)
+}
+
+// Moves HEAD to the commit and resets the index and working directory to its tree. The
+// index and working directory must be clean.
+func resetHardToCommit(hash []byte, reason string) {
+  commit, err := core.GetCommitObject(hash)
+  if err != nil {
+    PrintAndExit(err.Error())
+  }
+  checkoutTree(commit.GetCATree())
+  core.UpdateHead(hash, reason)
+}
+
+// Resets the index and working directory to the tree, HEAD is not touched. The index
+// and working directory must be clean.
+func checkoutTree(tree core.Tree) {
+  idxTree := core.GetIndexTree()
+  current := core.NewMemTree()
+  current.CopyFrom(idxTree, "/")
+  updateWorkTree(current, tree)
+  idxTree.CopyFrom(tree, "/")
+}
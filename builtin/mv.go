@@ -0,0 +1,144 @@
+package builtin
+
+import (
+  "flag"
+  "fmt"
+  "github.com/easonliao/flea/core"
+  "os"
+  "path"
+  "path/filepath"
+)
+
+func UsageMv() {
+  usage :=
+  `Usage: flea mv [-f] <source>... <destination>
+
+  Moves or renames the tracked files and directories, both in working directory and the
+  index. With more than one source, the destination must be an existing directory and the
+  sources are moved into it. A source is also moved into the destination if it's an
+  existing directory.
+
+  -f: Overwrite the destination files which already exist.
+  `
+  fmt.Println(usage)
+  os.Exit(1)
+}
+
+// A source to move and where it's moved to, both are tree paths.
+type moveItem struct {
+  src string
+  dst string
+}
+
+func CmdMv() error {
+  flags := flag.NewFlagSet("mv", 0)
+  force := flags.Bool("f", false, "force")
+  flags.Parse(os.Args[2:])
+  if flags.NArg() < 2 {
+    UsageMv()
+  }
+  args := flags.Args()
+  dst := argToTreePath(args[len(args) - 1])
+  dstIsDir := isWorkDir(dst)
+  if len(args) > 2 && !dstIsDir {
+    PrintAndExit(fmt.Sprintf("Destination %s is not a directory.", args[len(args) - 1]))
+  }
+  items := make([]moveItem, 0, len(args) - 1)
+  for _, arg := range(args[:len(args) - 1]) {
+    item := moveItem{src : argToTreePath(arg), dst : dst}
+    if dstIsDir {
+      item.dst = path.Join(dst, path.Base(item.src))
+    }
+    checkMove(item, arg, *force)
+    items = append(items, item)
+  }
+
+  idxTree := core.GetIndexTree()
+  for _, item := range(items) {
+    srcFsPath := treePathToFsPath(item.src)
+    dstFsPath := treePathToFsPath(item.dst)
+    if _, err := idxTree.Get(item.dst); err == nil {
+      // Only files can be overwritten, it's checked before.
+      if err := deleteFromIndex(item.dst); err != nil {
+        return err
+      }
+    }
+    if err := os.Rename(srcFsPath, dstFsPath); err != nil {
+      return err
+    }
+    if err := idxTree.Move(item.src, item.dst); err != nil {
+      return err
+    }
+    removeEmptyParents(item.src)
+  }
+  return nil
+}
+
+// Exits if the source can't be moved to the destination.
+func checkMove(item moveItem, arg string, force bool) {
+  if item.src == "/" {
+    PrintAndExit("Can't move the root of the repository.")
+  }
+  node, err := core.GetIndexTree().Get(item.src)
+  if err != nil {
+    PrintAndExit(fmt.Sprintf("Not under version control: %s", arg))
+  }
+  if _, err := os.Lstat(treePathToFsPath(item.src)); err != nil {
+    PrintAndExit(fmt.Sprintf("Bad source: %s doesn't exist.", arg))
+  }
+  if item.dst == item.src || (node.IsDir() && isUnder(item.dst, item.src)) {
+    PrintAndExit(fmt.Sprintf("Can't move %s into itself.", arg))
+  }
+  if !isWorkDir(path.Dir(item.dst)) {
+    PrintAndExit(fmt.Sprintf("Destination directory of %s doesn't exist.",
+                             TreePathToRelFsPath(item.dst)))
+  }
+  _, idxErr := core.GetIndexTree().Get(item.dst)
+  _, fsErr := os.Lstat(treePathToFsPath(item.dst))
+  if idxErr != nil && fsErr != nil {
+    return
+  }
+  if !force {
+    PrintAndExit(fmt.Sprintf("Destination %s exists, use -f to overwrite it.",
+                             TreePathToRelFsPath(item.dst)))
+  }
+  if isWorkDir(item.dst) {
+    PrintAndExit(fmt.Sprintf("Can't overwrite directory %s.", TreePathToRelFsPath(item.dst)))
+  }
+}
+
+// Deletes the directories in working directory and the index which become empty after
+// the path is moved away.
+func removeEmptyParents(treePath string) {
+  idxTree := core.GetIndexTree()
+  for dir := path.Dir(treePath); dir != "/"; dir = path.Dir(dir) {
+    if node, err := idxTree.Get(dir); err == nil && len(node.GetChildren()) == 0 {
+      idxTree.Delete(dir)
+    }
+    if os.Remove(treePathToFsPath(dir)) != nil {
+      break
+    }
+  }
+}
+
+// Converts the argument relative to current directory to the tree path.
+func argToTreePath(arg string) string {
+  return path.Clean(filepath.ToSlash(filepath.Join(core.GetPathPrefix(), arg)))
+}
+
+// Gets the full path in working directory of the tree path.
+func treePathToFsPath(treePath string) string {
+  return filepath.Join(core.GetRepoDirectory(), TreePathToRelFsPath(treePath))
+}
+
+// Checks whether the tree path is a directory in working directory, symlinks to
+// directories are not.
+func isWorkDir(treePath string) bool {
+  fi, err := os.Lstat(treePathToFsPath(treePath))
+  return err == nil && fi.IsDir()
+}
+
+// Checks whether the tree path is under the directory.
+func isUnder(treePath, dir string) bool {
+  return dir == "/" || len(treePath) > len(dir) && treePath[:len(dir) + 1] == dir + "/"
+}
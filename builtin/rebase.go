@@ -0,0 +1,170 @@
+package builtin
+
+import (
+  "bytes"
+  "encoding/hex"
+  "flag"
+  "fmt"
+  "github.com/easonliao/flea/core"
+  "os"
+  "path/filepath"
+)
+
+func UsageRebase() {
+  usage :=
+  `Usage: flea rebase [-i] <upstream>
+       flea rebase (--continue|--skip|--abort)
+
+  Replays the commits of current branch which are not in <upstream> on top of
+  <upstream>, then moves the branch to the last replayed commit.
+
+  -i: Edit the list of commits to replay before starting. Each line of the list is
+      "<command> <hash> <subject>", the commands are:
+        pick:   use the commit
+        reword: use the commit, but edit the message
+        edit:   apply the changes but stop before committing, so they can be amended
+        squash: meld the commit into the previous one, and edit the combined message
+        fixup:  like squash, but keep the message of the previous commit
+        drop:   remove the commit, the same as deleting the line
+  --continue: Go on after the conflicts have been resolved and marked with
+              "flea add <path>", or after the changes of an edit have been amended.
+  --skip: Skip the commit which stopped.
+  --abort: Cancel the rebase and restore the branch, the index and working directory.
+  `
+  fmt.Println(usage)
+  os.Exit(1)
+}
+
+const rebaseTodoHelp = `
+# Rebase %x onto %x (%d commands)
+#
+# Commands:
+# p, pick <commit> = use commit
+# r, reword <commit> = use commit, but edit the commit message
+# e, edit <commit> = use commit, but stop for amending
+# s, squash <commit> = use commit, but meld into previous commit
+# f, fixup <commit> = like "squash", but discard this commit's message
+# d, drop <commit> = remove commit
+#
+# These lines can be re-ordered; they are executed from top to bottom.
+# If you remove a line here that commit will be dropped.
+# However, if you remove everything, the rebase will be aborted.
+`
+
+func CmdRebase() error {
+  flags := flag.NewFlagSet("rebase", 0)
+  interactive := flags.Bool("i", false, "interactive")
+  cont := flags.Bool("continue", false, "continue")
+  skip := flags.Bool("skip", false, "skip")
+  abort := flags.Bool("abort", false, "abort")
+  flags.Parse(os.Args[2:])
+
+  if *cont || *skip || *abort {
+    seq := loadSequencerOrExit("rebase")
+    switch {
+    case *abort:
+      abortSequencer(seq)
+    case *skip:
+      skipSequencer(seq)
+    default:
+      continueSequencer(seq)
+    }
+    return nil
+  }
+  if flags.NArg() != 1 {
+    UsageRebase()
+  }
+  ensureNoSequencer()
+  head, err := core.GetHeadHash()
+  if err != nil {
+    PrintAndExit("Can't rebase, there's no commit yet.")
+  }
+  upstream := flags.Arg(0)
+  _, onto := ResolveCommitOrExit(upstream)
+  hashs, err := core.ListCommits(onto, head)
+  if err != nil {
+    PrintAndExit(err.Error())
+  }
+  if upToDate, _ := core.ListCommits(head, onto); len(upToDate) == 0 && !*interactive {
+    // The commits are already on top of upstream.
+    fmt.Println("Current branch is up to date.")
+    return nil
+  }
+  ensureNoLocalChanges("rebase")
+
+  seq := &core.Sequencer{Command : "rebase", OrigHead : head, Onto : onto}
+  seq.HeadName, _ = core.GetCurrentBranch()
+  for i := len(hashs) - 1; i >= 0; i-- {
+    commit, _ := core.GetCommitObject(hashs[i])
+    seq.Todo = append(seq.Todo, core.TodoItem{
+      Action : core.TodoPick,
+      Hash : hashs[i],
+      Subject : core.FirstLine(commit.Comment),
+    })
+  }
+  if *interactive {
+    editRebaseTodo(seq)
+  }
+
+  // Detaches HEAD and replays the commits onto upstream.
+  ontoCommit, _ := core.GetCommitObject(onto)
+  checkoutTree(ontoCommit.GetCATree())
+  core.WriteHeadFile([]byte(hex.EncodeToString(onto)), "rebase (start): checkout " + upstream)
+  runSequencer(seq)
+  return nil
+}
+
+// Lets users edit the todo list of the sequencer, exits if the list is invalid or empty.
+func editRebaseTodo(seq *core.Sequencer) {
+  if err := seq.Save(); err != nil {
+    PrintAndExit("Failed to save the sequencer: " + err.Error())
+  }
+  todoFile := filepath.Join(core.GetFleaDirectory(), core.SequencerDir, "todo")
+  help := fmt.Sprintf(rebaseTodoHelp, seq.OrigHead[:4], seq.Onto[:4], len(seq.Todo))
+  f, err := os.OpenFile(todoFile, os.O_APPEND | os.O_WRONLY, 0666)
+  if err == nil {
+    _, err = f.WriteString(help)
+    f.Close()
+  }
+  if err == nil {
+    err = launchEditor(todoFile)
+  }
+  if err != nil {
+    core.RemoveSequencer()
+    PrintAndExit("Failed to edit the todo list: " + err.Error())
+  }
+  loaded, err := core.LoadSequencer()
+  if err != nil {
+    core.RemoveSequencer()
+    PrintAndExit("Invalid todo list, the rebase is aborted.")
+  }
+  if len(loaded.Todo) == 0 {
+    core.RemoveSequencer()
+    PrintAndExit("Nothing to do.")
+  }
+  for _, item := range(loaded.Todo) {
+    if item.Action == core.TodoSquash || item.Action == core.TodoFixup {
+      core.RemoveSequencer()
+      PrintAndExit(fmt.Sprintf("Can't %s without a previous commit.", item.Action))
+    } else if item.Action != core.TodoDrop {
+      break
+    }
+  }
+  seq.Todo = loaded.Todo
+}
+
+// Moves the branch to the replayed commits and makes HEAD point to it again.
+func finishRebase(seq *core.Sequencer) {
+  head, _ := core.GetHeadHash()
+  if seq.HeadName == "" {
+    fmt.Printf("Successfully rebased and HEAD is now at %x.\n", head[:4])
+    return
+  }
+  reason := fmt.Sprintf("rebase finished: refs/heads/%s onto %x", seq.HeadName, seq.Onto)
+  if !bytes.Equal(head, core.GetBranchHead(seq.HeadName)) {
+    core.UpdateBranchHead(seq.HeadName, head, reason)
+  }
+  core.WriteHeadFile([]byte("ref:" + seq.HeadName),
+                     "rebase finished: returning to refs/heads/" + seq.HeadName)
+  fmt.Printf("Successfully rebased and updated refs/heads/%s.\n", seq.HeadName)
+}
@@ -0,0 +1,40 @@
+package builtin
+
+import (
+  "fmt"
+  "github.com/easonliao/flea/core"
+  "os"
+)
+
+func UsageReflog() {
+  usage :=
+  `Usage: flea reflog [<ref>]
+
+  Show the updates of <ref>, which is HEAD by default. Entries can be referred as
+  <ref>@{N} in revisions, e.g. HEAD@{2} or master@{1}.
+  `
+  fmt.Println(usage)
+  os.Exit(1)
+}
+
+func CmdReflog() error {
+  if len(os.Args) > 3 {
+    UsageReflog()
+  }
+  name := "HEAD"
+  if len(os.Args) == 3 {
+    name = os.Args[2]
+  }
+  refPath, err := core.GetRefPath(name)
+  if err != nil {
+    PrintAndExit(revisionErrorString(name, err))
+  }
+  entries, err := core.ReadReflog(refPath)
+  if err != nil {
+    return err
+  }
+  for i, entry := range(entries) {
+    fmt.Printf("%x %s@{%d}: %s\n", entry.New[:4], name, i, entry.Reason)
+  }
+  return nil
+}
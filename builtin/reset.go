@@ -0,0 +1,115 @@
+package builtin
+
+import (
+  "flag"
+  "fmt"
+  "github.com/easonliao/flea/core"
+  "os"
+  "path/filepath"
+)
+
+func UsageReset() {
+  usage :=
+  `Usage: flea reset [--soft|--mixed|--hard] [<revision>]
+       flea reset [<revision>] [--] <path>...
+
+  Moves the head of current branch to <revision>, which is HEAD by default.
+
+  --soft: Only moves the head, the index and working directory are left alone.
+  --mixed: Also resets the index to the tree of <revision>, but not the working
+           directory. This is the default mode.
+  --hard: Also resets the index and working directory to the tree of <revision>.
+          Changes to tracked files are discarded.
+
+  With paths, the index entries of the paths are reset to their state in <revision>,
+  i.e. the paths are unstaged. HEAD and working directory are not touched.
+  `
+  fmt.Println(usage)
+  os.Exit(1)
+}
+
+func CmdReset() error {
+  args, paths, dashDash := splitDashDash(os.Args[2:])
+  flags := flag.NewFlagSet("reset", 0)
+  soft := flags.Bool("soft", false, "soft")
+  mixed := flags.Bool("mixed", false, "mixed")
+  hard := flags.Bool("hard", false, "hard")
+  flags.Parse(args)
+  args = flags.Args()
+
+  rev := "HEAD"
+  if !dashDash && len(args) > 0 {
+    // Without "--" the first argument is a revision only if it can be resolved.
+    if _, _, err := core.ResolveCommit(args[0]); err == nil {
+      rev, paths = args[0], args[1:]
+    } else {
+      paths = args
+    }
+  } else if len(args) == 1 {
+    rev = args[0]
+  } else if len(args) > 1 {
+    UsageReset()
+  }
+
+  if len(paths) > 0 {
+    if *soft || *mixed || *hard {
+      PrintAndExit("Can't do soft, mixed or hard reset with paths.")
+    }
+    resetPaths(rev, paths)
+    return nil
+  }
+
+  modes := 0
+  for _, mode := range([]bool{*soft, *mixed, *hard}) {
+    if mode {
+      modes++
+    }
+  }
+  if modes > 1 {
+    PrintAndExit("Only one of --soft, --mixed and --hard can be given.")
+  }
+  if _, err := core.GetHeadHash(); err != nil {
+    PrintAndExit("There's no commit to reset.")
+  }
+  commit, hash := ResolveCommitOrExit(rev)
+  if *hard {
+    // Deletes the files tracked by current commit or index before restoring the files
+    // of target commit, so files which don't exist in target commit are removed.
+    current, _ := core.GetCurrentCommit()
+    deleteFilesOfTrees(current.GetCATree(), core.GetIndexTree())
+    restoreRepoFromCommit(commit)
+  } else if !*soft {
+    if err := core.GetIndexTree().CopyFrom(commit.GetCATree(), "/"); err != nil {
+      return err
+    }
+  }
+  core.UpdateHead(hash, "reset: moving to " + rev)
+  if *hard {
+    fmt.Printf("HEAD is now at %x %s\n", hash[:4], core.FirstLine(commit.Comment))
+  }
+  return nil
+}
+
+// Resets the index entries of the paths to their state in the revision.
+func resetPaths(rev string, paths []string) {
+  var tree core.Tree
+  if _, err := core.GetHeadHash(); err == nil || rev != "HEAD" {
+    commit, _ := ResolveCommitOrExit(rev)
+    tree = commit.GetCATree()
+  } else {
+    // There's no commit yet, unstaging a path removes it from the index.
+    tree = core.NewMemTree()
+  }
+  idxTree := core.GetIndexTree()
+  for _, p := range(paths) {
+    treePath := filepath.ToSlash(filepath.Join(core.GetPathPrefix(), p))
+    _, errIdx := idxTree.Get(treePath)
+    _, errTree := tree.Get(treePath)
+    if errIdx == core.ErrPathNotExist && errTree == core.ErrPathNotExist {
+      PrintAndExit(fmt.Sprintf("Path %s doesn't match any file in index or %s.", p, rev))
+    }
+    if err := idxTree.CopyFrom(tree, treePath); err != nil {
+      PrintAndExit(err.Error())
+    }
+  }
+}
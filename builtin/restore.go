@@ -0,0 +1,96 @@
+package builtin
+
+import (
+  "flag"
+  "fmt"
+  "github.com/easonliao/flea/core"
+  "os"
+)
+
+func UsageRestore() {
+  usage :=
+  `Usage: flea restore [--source=<revision>] [--staged] [--worktree] <pathspec>...
+
+  Restores the files matching the pathspec in working directory from the index, or in
+  the index from HEAD with --staged, HEAD doesn't move. Tracked files which don't exist
+  in the source are deleted.
+
+  --source: Restore from the tree of the revision instead.
+  --staged: Restore the index, working directory is left alone unless --worktree is given.
+  --worktree: Restore working directory, it's the default without --staged.
+  `
+  fmt.Println(usage)
+  os.Exit(1)
+}
+
+func CmdRestore() error {
+  flags := flag.NewFlagSet("restore", 0)
+  source := flags.String("source", "", "source revision")
+  staged := flags.Bool("staged", false, "restore the index")
+  worktree := flags.Bool("worktree", false, "restore working directory")
+  args, paths, _ := splitDashDash(os.Args[2:])
+  flags.Parse(args)
+  paths = append(flags.Args(), paths...)
+  if len(paths) == 0 {
+    UsageRestore()
+  }
+  if !*staged {
+    *worktree = true
+  }
+  ps := ParsePathspecOrExit(paths)
+  idxTree := core.GetIndexTree()
+  var tree core.Tree = idxTree
+  if *source != "" {
+    commit, _ := ResolveCommitOrExit(*source)
+    tree = commit.GetCATree()
+  } else if *staged {
+    if commit, err := core.GetCurrentCommit(); err == nil {
+      tree = commit.GetCATree()
+    } else if err == core.ErrNoHeadFile {
+      // There's no commit yet, restoring the index unstages everything.
+      tree = core.NewMemTree()
+    } else {
+      return err
+    }
+  }
+
+  files := ps.MatchFiles(tree)
+  // Tracked files which are not in the source.
+  deleted := make([]string, 0)
+  if tree != core.Tree(idxTree) {
+    for _, treePath := range(ps.MatchFiles(idxTree)) {
+      if _, err := tree.Get(treePath); err != nil {
+        deleted = append(deleted, treePath)
+      }
+    }
+  }
+  ensurePathspecMatched(ps, append(append([]string(nil), files...), deleted...))
+
+  for _, treePath := range(deleted) {
+    if *worktree {
+      deleteFromWorkDir(treePath)
+    }
+    if *staged {
+      if err := deleteFromIndex(treePath); err != nil {
+        return err
+      }
+      core.ResolveConflicts(treePath)
+    }
+  }
+  for _, treePath := range(files) {
+    node, _ := tree.Get(treePath)
+    if *staged {
+      if err := idxTree.MkFileAllMode(treePath, node.GetHashValue(),
+                                      node.GetMode()); err != nil {
+        return err
+      }
+      core.ResolveConflicts(treePath)
+    }
+    if *worktree {
+      if err := restoreWorkFile(tree, treePath); err != nil {
+        return err
+      }
+    }
+  }
+  return nil
+}
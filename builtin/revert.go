@@ -0,0 +1,112 @@
+package builtin
+
+import (
+  "encoding/hex"
+  "flag"
+  "fmt"
+  "github.com/easonliao/flea/core"
+  "os"
+)
+
+func UsageRevert() {
+  usage :=
+  `Usage: flea revert <revision>
+       flea revert (--continue|--abort)
+
+  Creates a new commit which reverts the changes introduced by <revision>. The inverse
+  of the changes is merged into HEAD, if it doesn't apply cleanly the command stops with
+  conflicts.
+
+  --continue: Create the commit after the conflicts have been resolved and marked with
+              "flea add <path>".
+  --abort: Cancel the revert and restore the index and working directory to HEAD.
+  `
+  fmt.Println(usage)
+  os.Exit(1)
+}
+
+func CmdRevert() error {
+  flags := flag.NewFlagSet("revert", 0)
+  cont := flags.Bool("continue", false, "continue")
+  abort := flags.Bool("abort", false, "abort")
+  flags.Parse(os.Args[2:])
+
+  inProgress := core.HasStateFile(core.RevertHeadFile)
+  switch {
+  case *cont || *abort:
+    if !inProgress {
+      PrintAndExit("There's no revert in progress.")
+    }
+    if *abort {
+      resetHardToHead()
+      clearRevertState()
+      return nil
+    }
+    return continueRevert()
+  case inProgress:
+    PrintAndExit("A revert is in progress, use --continue or --abort.")
+  case flags.NArg() != 1:
+    UsageRevert()
+  }
+
+  ensureNoSequencer()
+  ensureNoLocalChanges("revert")
+  commit, hash := ResolveCommitOrExit(flags.Arg(0))
+  // The tree of the parent, an empty tree if the commit is the root commit.
+  var parentTree core.Tree = core.NewMemTree()
+  if parent := commit.GetPrevCommit(); parent != nil {
+    parentTree = parent.GetCATree()
+  }
+  message := fmt.Sprintf("Revert \"%s\"\n\nThis reverts commit %x.", core.FirstLine(commit.Comment),
+                         hash)
+  labels := core.MergeLabels{Ours : "HEAD", Theirs : fmt.Sprintf("parent of %x", hash[:4])}
+  // The inverse change is from the commit to its parent.
+  conflicts, err := mergeIntoWorkTree(commit.GetCATree(), parentTree, labels)
+  if err != nil {
+    os.Exit(1)
+  }
+  if len(conflicts) > 0 {
+    core.WriteStateFile(core.RevertHeadFile, []byte(hex.EncodeToString(hash)))
+    core.WriteStateFile(core.MergeMsgFile, []byte(message))
+    fmt.Printf("Could not revert %x.\n", hash[:4])
+    printConflicts(conflicts, "revert")
+    os.Exit(1)
+  }
+  createRevertCommit(message)
+  return nil
+}
+
+func continueRevert() error {
+  if len(core.ReadConflicts()) > 0 {
+    PrintAndExit("There are still unresolved conflicts, mark them with \"flea add <path>\".")
+  }
+  message, _ := core.ReadStateFile(core.MergeMsgFile)
+  createRevertCommit(string(message))
+  clearRevertState()
+  return nil
+}
+
+func createRevertCommit(message string) {
+  if !hasStagedChanges() {
+    fmt.Println("There's nothing to commit, the changes have already been reverted.")
+    return
+  }
+  author, err := core.GetAuthorIdent()
+  if err != nil {
+    PrintAndExit(err.Error())
+  }
+  committer, err := core.GetCommitterIdent()
+  if err != nil {
+    PrintAndExit(err.Error())
+  }
+  hash, err := commitIndex(author, committer, message, "revert")
+  if err != nil {
+    PrintAndExit("Failed to create the commit object: " + err.Error())
+  }
+  fmt.Printf("[%s %x] %s\n", describeHeadShort(), hash[:4], core.FirstLine(message))
+}
+
+func clearRevertState() {
+  core.RemoveStateFile(core.RevertHeadFile)
+  core.RemoveStateFile(core.MergeMsgFile)
+}
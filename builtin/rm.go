@@ -5,12 +5,13 @@ import (
   "fmt"
   "github.com/easonliao/flea/core"
   "os"
-  "path/filepath"
 )
 
 func UsageRm() {
   usage :=
-  `Usage: flea rm [--cached] (<file>|<directory>)
+  `Usage: flea rm [--cached] <pathspec>...
+
+  Removes the files matching the pathspec from the index and working directory.
 
   --cached: use this option to unstage and remove paths only from the index.
             Working tree files, whether modified or not, will be left alone.
@@ -28,23 +29,28 @@ func CmdRm() error {
   flags := flag.NewFlagSet("rm", 0)
   cached := flags.Bool("cached", false, "delete file/directory from index tree")
   flags.Parse(os.Args[2:])
+  if flags.NArg() == 0 {
+    UsageRm()
+  }
 
-  rmPath := os.Args[len(os.Args) - 1]
-  treePath := filepath.ToSlash(filepath.Join(core.GetPathPrefix(), rmPath))
-  indexTree := core.GetIndexTree()
-
-  if err := indexTree.Delete(treePath); err == nil {
+  ps := ParsePathspecOrExit(flags.Args())
+  files := ps.MatchFiles(core.GetIndexTree())
+  if len(files) == 0 {
+    fmt.Println("Can't find the path in index tree.")
+    os.Exit(1)
+  }
+  ensurePathspecMatched(ps, files)
+  for _, treePath := range(files) {
+    if err := deleteFromIndex(treePath); err != nil {
+      fmt.Println(err.Error())
+      os.Exit(1)
+    }
+    // Removing a path marks its conflicts as resolved.
+    core.ResolveConflicts(treePath)
     if *cached == false {
       // We need also deleting the path from working directory.
-      fullPath := filepath.Join(core.GetRepoDirectory(), TreePathToRelFsPath(treePath))
-      os.Remove(fullPath)
+      deleteFromWorkDir(treePath)
     }
-  } else if err == core.ErrPathNotExist {
-    fmt.Println("Can't find the path in index tree.")
-    os.Exit(1)
-  } else {
-    fmt.Println(err.Error())
-    os.Exit(1)
   }
   return nil
 }
@@ -0,0 +1,210 @@
+package builtin
+
+import (
+  "fmt"
+  "github.com/easonliao/flea/core"
+  "os"
+  "strings"
+)
+
+// Replays the items of the todo list one by one. If an item stops with conflicts or for
+// editing, the state is saved and the command exits, it's continued by runSequencer
+// later.
+func runSequencer(seq *core.Sequencer) {
+  for len(seq.Todo) > 0 {
+    item := seq.Todo[0]
+    seq.Todo = seq.Todo[1:]
+    if item.Action == core.TodoDrop {
+      continue
+    }
+    seq.Current = &item
+    if err := seq.Save(); err != nil {
+      PrintAndExit("Failed to save the sequencer: " + err.Error())
+    }
+    if !pickCommit(seq, item) {
+      os.Exit(1)
+    }
+    seq.Current = nil
+  }
+  if seq.Command == "rebase" {
+    finishRebase(seq)
+  }
+  core.RemoveSequencer()
+}
+
+// Merges the changes introduced by the commit of the item into HEAD and commits them.
+// Returns false if there are conflicts.
+func pickCommit(seq *core.Sequencer, item core.TodoItem) bool {
+  commit, err := core.GetCommitObject(item.Hash)
+  if err != nil {
+    PrintAndExit(fmt.Sprintf("Failed to read commit %x: %s", item.Hash, err.Error()))
+  }
+  // The tree of the parent, an empty tree if the commit is the root commit.
+  var parentTree core.Tree = core.NewMemTree()
+  if parent := commit.GetPrevCommit(); parent != nil {
+    parentTree = parent.GetCATree()
+  }
+  labels := core.MergeLabels{
+    Ours : "HEAD",
+    Theirs : fmt.Sprintf("%x... %s", item.Hash[:4], core.FirstLine(commit.Comment)),
+  }
+  conflicts, err := mergeIntoWorkTree(parentTree, commit.GetCATree(), labels)
+  if err != nil {
+    // Nothing has been changed, the item is tried again when continuing.
+    seq.Todo = append([]core.TodoItem{item}, seq.Todo...)
+    seq.Current = nil
+    seq.Save()
+    return false
+  }
+  if len(conflicts) > 0 {
+    seq.Save()
+    fmt.Printf("Could not apply %x... %s\n", item.Hash[:4], core.FirstLine(commit.Comment))
+    printConflicts(conflicts, seq.Command)
+    return false
+  }
+  if item.Action == core.TodoEdit {
+    // Stops with the changes staged so they can be amended before committing.
+    seq.Save()
+    fmt.Printf("Stopped at %x... %s\n", item.Hash[:4], core.FirstLine(commit.Comment))
+    fmt.Println("The changes are staged, you can amend them now. Run")
+    fmt.Printf("\"flea %s --continue\" to commit them.\n", seq.Command)
+    return false
+  }
+  commitPicked(seq, item, commit)
+  return true
+}
+
+// Commits the staged changes with the author and message of the picked commit. Squash
+// and fixup meld the changes into HEAD instead.
+func commitPicked(seq *core.Sequencer, item core.TodoItem, commit *core.Commit) {
+  committer, err := core.GetCommitterIdent()
+  if err != nil {
+    PrintAndExit(err.Error())
+  }
+  if item.Action == core.TodoSquash || item.Action == core.TodoFixup {
+    if seq.Committed {
+      squashIntoHead(seq, item, commit, committer)
+      return
+    }
+    // HEAD isn't created by this run, e.g. the commits before were skipped, melding into
+    // it would rewrite a commit outside of the replayed ones.
+    fmt.Printf("Nothing to %s into, \"%s\" is picked instead.\n", item.Action,
+               core.FirstLine(commit.Comment))
+  }
+  if !hasStagedChanges() {
+    fmt.Printf("The changes of \"%s\" are already in HEAD, skipped.\n",
+               core.FirstLine(commit.Comment))
+    return
+  }
+  message := commit.Comment
+  if item.Action == core.TodoReword {
+    message = editMessageOrExit(message, "Please enter the commit message for the commit.")
+  }
+  hash, err := commitIndex(commit.GetAuthor(), committer, message, seq.Command)
+  if err != nil {
+    PrintAndExit("Failed to create the commit object: " + err.Error())
+  }
+  seq.Committed = true
+  fmt.Printf("[%s %x] %s\n", describeHeadShort(), hash[:4], core.FirstLine(message))
+}
+
+// Replaces HEAD with a commit which has the staged changes melded in. The message of
+// squash is the messages of both commits, fixup keeps the message of HEAD.
+func squashIntoHead(seq *core.Sequencer, item core.TodoItem, commit *core.Commit,
+                    committer core.Signature) {
+  head, err := core.GetCurrentCommit()
+  if err != nil {
+    PrintAndExit(err.Error())
+  }
+  message := head.Comment
+  if item.Action == core.TodoSquash {
+    message = strings.TrimRight(head.Comment, "\n") + "\n\n" + commit.Comment
+    message = editMessageOrExit(message, "This is a combination of 2 commits.\n" +
+                                "Please enter the commit message for the combined commit.")
+  }
+  caTree, err := core.BuildCATreeFromIndexFile()
+  if err != nil {
+    PrintAndExit(err.Error())
+  }
+  hash, err := core.CreateCommitObject(caTree.GetHash(), head.PrevCommit, head.GetAuthor(),
+                                       committer, message)
+  if err != nil {
+    PrintAndExit("Failed to create the commit object: " + err.Error())
+  }
+  core.UpdateHead(hash, fmt.Sprintf("%s (%s): %s", seq.Command, item.Action,
+                                    core.FirstLine(message)))
+  seq.Committed = true
+  fmt.Printf("[%s %x] %s\n", describeHeadShort(), hash[:4], core.FirstLine(message))
+}
+
+// Lets users edit the message, exits if the editor fails or the message is empty.
+func editMessageOrExit(message, help string) string {
+  help += "\nLines starting with '#' will be ignored, an empty message aborts the commit."
+  edited, err := editMessage(message, "COMMIT_EDITMSG", help)
+  if err != nil {
+    PrintAndExit("Failed to edit the message: " + err.Error())
+  }
+  if edited == "" {
+    PrintAndExit("Aborting commit due to empty commit message.")
+  }
+  return edited
+}
+
+// Continues the sequencer after the conflicts of current item have been resolved.
+func continueSequencer(seq *core.Sequencer) {
+  if len(core.ReadConflicts()) > 0 {
+    PrintAndExit("There are still unresolved conflicts, mark them with \"flea add <path>\".")
+  }
+  if hasUnstagedChanges() {
+    PrintAndExit("You have unstaged changes, please add them first.")
+  }
+  if seq.Current != nil {
+    commit, err := core.GetCommitObject(seq.Current.Hash)
+    if err != nil {
+      PrintAndExit(err.Error())
+    }
+    commitPicked(seq, *seq.Current, commit)
+    seq.Current = nil
+    seq.Save()
+  }
+  runSequencer(seq)
+}
+
+// Skips current item of the sequencer, its changes are discarded.
+func skipSequencer(seq *core.Sequencer) {
+  resetHardToHead()
+  seq.Current = nil
+  runSequencer(seq)
+}
+
+// Aborts the sequencer, HEAD, the index and working directory are restored to the state
+// before the command started.
+func abortSequencer(seq *core.Sequencer) {
+  resetHardToHead()
+  resetHardToCommit(seq.OrigHead, seq.Command + ": abort")
+  if seq.HeadName != "" {
+    core.WriteHeadFile([]byte("ref:" + seq.HeadName), seq.Command + ": abort")
+  }
+  core.RemoveSequencer()
+}
+
+// Loads the sequencer started by the command, exits if there's none.
+func loadSequencerOrExit(command string) *core.Sequencer {
+  seq, err := core.LoadSequencer()
+  if err == core.ErrNoSequencer || (err == nil && seq.Command != command) {
+    PrintAndExit(fmt.Sprintf("There's no %s in progress.", command))
+  } else if err != nil {
+    PrintAndExit("Failed to load the sequencer: " + err.Error())
+  }
+  return seq
+}
+
+// Exits if a sequencer or revert is in progress.
+func ensureNoSequencer() {
+  if seq, err := core.LoadSequencer(); err == nil {
+    PrintAndExit(fmt.Sprintf("A %s is in progress, use \"flea %s --continue\" or --abort.",
+                             seq.Command, seq.Command))
+  } else if core.HasSequencer() || core.HasStateFile(core.RevertHeadFile) {
+    PrintAndExit("Another command is in progress, please finish it first.")
+  }
+}
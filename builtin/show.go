@@ -0,0 +1,114 @@
+package builtin
+
+import (
+  "flag"
+  "fmt"
+  "github.com/easonliao/flea/core"
+  "os"
+  "sort"
+)
+
+func UsageShow() {
+  usage :=
+  `Usage: flea show [--stat|--name-status] [<revision>...]
+
+  Shows the objects, HEAD by default. A revision can be in the form of <rev>:<path> to
+  show a file or directory in the tree of <rev>.
+
+  commits: The header of the commit and the diff against its parent.
+  trees: The names of the entries, directories end with "/".
+  blobs: The content of the file.
+  tags: The annotation of the tag and the object it points to.
+
+  --stat: Show the number of changed lines per file instead of the diff.
+  --name-status: Show the changed files and how they were changed instead of the diff.
+  `
+  fmt.Println(usage)
+  os.Exit(1)
+}
+
+func CmdShow() error {
+  flags := flag.NewFlagSet("show", 0)
+  stat := flags.Bool("stat", false, "stat")
+  nameStatus := flags.Bool("name-status", false, "name status")
+  flags.Usage = UsageShow
+  flags.Parse(os.Args[2:])
+  revs := flags.Args()
+  if len(revs) == 0 {
+    revs = []string{"HEAD"}
+  }
+  for i, rev := range(revs) {
+    if i > 0 {
+      fmt.Println("")
+    }
+    hash := ResolveRevisionOrExit(rev)
+    showObject(rev, hash, showOptions{stat : *stat, nameStatus : *nameStatus})
+  }
+  return nil
+}
+
+// How to show the changes of commits, the diff is shown if neither is set.
+type showOptions struct {
+  stat bool
+  nameStatus bool
+}
+
+// Shows the object in the way of its type, name is how users refer to it.
+func showObject(name string, hash []byte, opts showOptions) {
+  fType, data, err := core.GetCAStore().Get(hash)
+  if err != nil {
+    PrintAndExit(err.Error())
+  }
+  switch fType {
+  case core.TagType:
+    tag, err := core.GetTagObject(hash)
+    if err != nil {
+      PrintAndExit(err.Error())
+    }
+    tagger := tag.GetTagger()
+    fmt.Printf("Tag: %s\n", tag.Tag)
+    fmt.Printf("Tagger: %s\n", tagger)
+    if !tagger.When.IsZero() {
+      fmt.Printf("Date: %s\n", formatLogDate(tagger.When))
+    }
+    fmt.Printf("Message: %s\n", tag.Message)
+    fmt.Println("")
+    showObject(tag.Tag, tag.Object, opts)
+  case core.CommitType:
+    commit, _ := core.GetCommitObject(hash)
+    fmt.Print(formatCommitMedium(commit, hash))
+    var parent *core.Commit
+    if commit.PrevCommit != nil {
+      parent, _ = core.GetCommitObject(commit.PrevCommit)
+    }
+    changes := commitChanges(commit, parent, nil)
+    switch {
+    case opts.stat:
+      fmt.Print(formatStat(changes))
+    case opts.nameStatus:
+      for _, change := range(changes) {
+        fmt.Printf("%c\t%s\n", change.Status, change.Path[1:])
+      }
+    default:
+      for _, change := range(changes) {
+        fmt.Print(formatFileDiff(change.Path[1:], change.Old, change.New))
+      }
+    }
+  case core.TreeType:
+    fmt.Printf("tree %s\n\n", name)
+    root, _ := core.GetCATree(hash).Get("/")
+    names := make([]string, 0)
+    for entry, node := range(root.GetChildren()) {
+      if node.IsDir() {
+        entry += "/"
+      }
+      names = append(names, entry)
+    }
+    sort.Strings(names)
+    for _, entry := range(names) {
+      fmt.Println(entry)
+    }
+  default:
+    os.Stdout.Write(data)
+  }
+}
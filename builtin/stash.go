@@ -0,0 +1,165 @@
+package builtin
+
+import (
+  "flag"
+  "fmt"
+  "github.com/easonliao/flea/core"
+  "os"
+)
+
+func UsageStash() {
+  usage :=
+  `Usage: flea stash [push [-m <message>]]
+       flea stash list
+       flea stash show [<stash>]
+       flea stash (apply|pop|drop) [<stash>]
+
+  Saves the changes of the index and the tracked files in working directory to a stack
+  of stash entries, and resets them to HEAD. <stash> is in the form of stash@{N} or N,
+  stash@{0} (the newest entry) by default.
+
+  push: Save the changes as a new entry, -m gives the description of the entry.
+  list: List the entries.
+  show: Show the files changed by the entry.
+  apply: Merge the changes of the entry into working directory, new files are added
+         to the index. The entry is kept.
+  pop: Like apply, the entry is dropped if it's applied without conflicts.
+  drop: Remove the entry.
+  `
+  fmt.Println(usage)
+  os.Exit(1)
+}
+
+func CmdStash() error {
+  args := os.Args[2:]
+  subcommand := "push"
+  if len(args) > 0 {
+    subcommand, args = args[0], args[1:]
+  }
+  switch subcommand {
+  case "push":
+    flags := flag.NewFlagSet("stash push", 0)
+    message := flags.String("m", "", "message")
+    flags.Parse(args)
+    if flags.NArg() != 0 {
+      UsageStash()
+    }
+    pushStash(*message)
+  case "list":
+    if len(args) != 0 {
+      UsageStash()
+    }
+    stashes, err := core.ListStash()
+    if err != nil {
+      PrintAndExit(err.Error())
+    }
+    for i, stash := range(stashes) {
+      fmt.Printf("stash@{%d}: %s\n", i, stash.Message)
+    }
+  case "show":
+    n, stash := getStashOrExit(args)
+    fmt.Printf("stash@{%d}: %s\n", n, stash.Message)
+    deleted, added, modified := core.CompareTrees(stash.Base.GetCATree(),
+                                                  stash.WorkTree.GetCATree())
+    for _, file := range(deleted) {
+      fmt.Printf("\tdeleted:\t%s\n", TreePathToRelFsPath(file))
+    }
+    for _, file := range(added) {
+      fmt.Printf("\tnew file:\t%s\n", TreePathToRelFsPath(file))
+    }
+    for _, file := range(modified) {
+      fmt.Printf("\tmodified:\t%s\n", TreePathToRelFsPath(file))
+    }
+  case "apply", "pop":
+    n, stash := getStashOrExit(args)
+    if !applyStash(stash) {
+      fmt.Println("The stash entry is kept in case you need it again.")
+      os.Exit(1)
+    }
+    if subcommand == "pop" {
+      dropStash(n, stash)
+    }
+  case "drop":
+    n, stash := getStashOrExit(args)
+    dropStash(n, stash)
+  default:
+    UsageStash()
+  }
+  return nil
+}
+
+// Saves the changes to a new stash entry and resets the index and working directory.
+func pushStash(message string) {
+  if len(core.ReadConflicts()) > 0 {
+    PrintAndExit("Can't stash, you have unresolved conflicts.")
+  }
+  stash, err := core.CreateStash(message)
+  if err == core.ErrNoHeadFile {
+    PrintAndExit("Can't stash, there's no commit yet.")
+  } else if err == core.ErrNoLocalChanges {
+    fmt.Println("No local changes to save.")
+    return
+  } else if err != nil {
+    PrintAndExit("Failed to save the stash: " + err.Error())
+  }
+  resetHardToHead()
+  fmt.Printf("Saved working directory and index state %s\n", stash.Message)
+}
+
+// Merges the changes of the stash into working directory, returns false if there are
+// conflicts. The changes are left unstaged except new files.
+func applyStash(stash *core.Stash) bool {
+  ensureNoLocalChanges("apply the stash")
+  idxTree := core.GetIndexTree()
+  orig := core.NewMemTree()
+  orig.CopyFrom(idxTree, "/")
+  labels := core.MergeLabels{Ours : "Updated upstream", Theirs : "Stashed changes"}
+  conflicts, err := mergeIntoWorkTree(stash.Base.GetCATree(), stash.WorkTree.GetCATree(),
+                                      labels)
+  if err != nil {
+    os.Exit(1)
+  }
+  // Only new files are kept in the index, so they are not lost as untracked files.
+  _, added, _ := core.CompareTrees(orig, idxTree)
+  result := core.NewMemTree()
+  result.CopyFrom(idxTree, "/")
+  idxTree.CopyFrom(orig, "/")
+  for _, treePath := range(added) {
+    idxTree.CopyFrom(result, treePath)
+  }
+  if len(conflicts) > 0 {
+    for _, conflict := range(conflicts) {
+      fmt.Printf("CONFLICT (%s): %s\n", conflict.Kind, TreePathToRelFsPath(conflict.Path))
+    }
+    fmt.Println("Resolve the conflicts and mark them with \"flea add <path>\".")
+    return false
+  }
+  return true
+}
+
+func dropStash(n int, stash *core.Stash) {
+  if err := core.DropStash(n); err != nil {
+    PrintAndExit(err.Error())
+  }
+  fmt.Printf("Dropped stash@{%d} (%x)\n", n, stash.Hash)
+}
+
+// Gets the stash entry given by the arguments, stash@{0} if there's none.
+func getStashOrExit(args []string) (int, *core.Stash) {
+  n := 0
+  if len(args) > 1 {
+    UsageStash()
+  } else if len(args) == 1 {
+    var err error
+    if n, err = core.ParseStashName(args[0]); err != nil {
+      PrintAndExit(fmt.Sprintf("%s is not a valid stash entry.", args[0]))
+    }
+  }
+  stash, err := core.GetStash(n)
+  if err == core.ErrNoStash {
+    PrintAndExit(fmt.Sprintf("stash@{%d} doesn't exist.", n))
+  } else if err != nil {
+    PrintAndExit(err.Error())
+  }
+  return n, stash
+}
@@ -1,17 +1,32 @@
 package builtin
 
 import (
+  "bytes"
   "fmt"
   "github.com/easonliao/flea/core"
   "os"
 )
 
 func UsageStatus() {
-  fmt.Println("Usage: flea status")
+  fmt.Println("Usage: flea status [<pathspec>...]")
   os.Exit(1)
 }
 
 func CmdStatus() error {
+  ps := ParsePathspecOrExit(os.Args[2:])
+  // Only shows the paths selected by the pathspec, the paths are in any of the trees.
+  filter := func(paths []string, trees ...core.Tree) []string {
+    selected := make([]string, 0, len(paths))
+    for _, p := range(paths) {
+      for _, tree := range(trees) {
+        if ps.MatchTree(tree, p) {
+          selected = append(selected, p)
+          break
+        }
+      }
+    }
+    return selected
+  }
   idxTree := core.GetIndexTree()
   fsTree := core.GetFsTree()
   commit, err := core.GetCurrentCommit()
@@ -25,10 +40,28 @@ func CmdStatus() error {
     commitTree = commit.GetCATree()
   }
 
+  unmerged := make([]core.UnmergedPath, 0)
+  for _, u := range(core.ReadUnmergedPaths()) {
+    if ps.Match(u.Path) {
+      unmerged = append(unmerged, u)
+    }
+  }
+  if len(unmerged) > 0 {
+    fmt.Println("Unmerged paths:")
+    fmt.Println("")
+    for _, u := range(unmerged) {
+      fmt.Printf("\t%s:\t%s\n", u.Kind, TreePathToRelFsPath(u.Path))
+    }
+    fmt.Println("")
+  }
+
   // First compares the commit tree(CATree) to staging area(IndexTree).
   deleted, newFiles, diffes := core.CompareTrees(commitTree, idxTree)
+  deleted, newFiles = filter(deleted, commitTree), filter(newFiles, idxTree)
+  diffes = filter(diffes, commitTree, idxTree)
   if len(deleted) > 0 || len(newFiles) > 0 || len(diffes) > 0 {
-    fmt.Println("Changes to be committed:\n")
+    fmt.Println("Changes to be committed:")
+    fmt.Println("")
     for _, file := range(deleted) {
       fmt.Printf("\tdeleted:\t%s\n", TreePathToRelFsPath(file))
     }
@@ -36,26 +69,30 @@ func CmdStatus() error {
       fmt.Printf("\tnew file:\t%s\n", TreePathToRelFsPath(file))
     }
     for _, file := range(diffes) {
-      fmt.Printf("\tmodified:\t%s\n", TreePathToRelFsPath(file))
+      fmt.Printf("\t%s\n", describeChange(commitTree, idxTree, file))
     }
     fmt.Println("")
   }
 
   // Compares the staging area(IndexTree) to working directory(FsTree).
   deleted, untracked, diffes := core.CompareTrees(idxTree, fsTree)
+  deleted, untracked = filter(deleted, idxTree), filter(untracked, fsTree)
+  diffes = filter(diffes, idxTree, fsTree)
   if len(deleted) > 0 || len(diffes) > 0 {
-    fmt.Println("Changes not statged for commit:\n")
+    fmt.Println("Changes not statged for commit:")
+    fmt.Println("")
     for _, file := range(deleted) {
       fmt.Printf("\tdeleted:\t%s\n", TreePathToRelFsPath(file))
     }
     for _, file := range(diffes) {
-      fmt.Printf("\tmodified:\t%s\n", TreePathToRelFsPath(file))
+      fmt.Printf("\t%s\n", describeChange(idxTree, fsTree, file))
     }
     fmt.Println("")
   }
 
   if len(untracked) > 0 {
-    fmt.Println("Untracked files/directories:\n")
+    fmt.Println("Untracked files/directories:")
+    fmt.Println("")
     for _, file := range(untracked) {
       fmt.Printf("\t%s\n", TreePathToRelFsPath(file))
     }
@@ -63,3 +100,26 @@ func CmdStatus() error {
   }
   return nil
 }
+
+// Describes the change of the file which differs between two trees as "<kind>:\t<path>".
+// The kind is "mode changed" if only the mode of the file is changed, retargeted symlinks
+// are shown with the new target.
+func describeChange(a, b core.Tree, treePath string) string {
+  relPath := TreePathToRelFsPath(treePath)
+  nodeA, errA := a.Get(treePath)
+  nodeB, errB := b.Get(treePath)
+  if errA != nil || errB != nil || nodeA.IsDir() || nodeB.IsDir() {
+    return "modified:\t" + relPath
+  }
+  modeA, modeB := nodeA.GetMode(), nodeB.GetMode()
+  switch {
+  case bytes.Equal(nodeA.GetHashValue(), nodeB.GetHashValue()):
+    return fmt.Sprintf("mode changed:\t%s (%s -> %s)", relPath, modeA, modeB)
+  case modeA == core.ModeSymlink && modeB == core.ModeSymlink:
+    target, _ := readNodeData(nodeB)
+    return fmt.Sprintf("retargeted:\t%s -> %s", relPath, target)
+  case modeA == core.ModeSymlink || modeB == core.ModeSymlink:
+    return "typechange:\t" + relPath
+  }
+  return "modified:\t" + relPath
+}
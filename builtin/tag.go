@@ -0,0 +1,99 @@
+package builtin
+
+import (
+  "flag"
+  "fmt"
+  "github.com/easonliao/flea/core"
+  "os"
+)
+
+func UsageTag() {
+  usage :=
+  `Usage: flea tag [-l]
+       flea tag [-f] [-a] [-m <msg>] <tagname> [<revision>]
+       flea tag -d <tagname>...
+       flea tag --show <tagname>
+
+  -l: List all the tags, this is the default if no tag name is given.
+  -a: Make an annotated tag object which records the tagger, date and message.
+  -m: Use the given <msg> as the tag message, implies -a.
+  -f: Replace an existing tag with the given name.
+  -d: Delete the tags with the given names.
+  --show: Show the tag and the object it points to.
+  `
+  fmt.Println(usage)
+  os.Exit(1)
+}
+
+func CmdTag() error {
+  flags := flag.NewFlagSet("tag", 0)
+  list := flags.Bool("l", false, "list")
+  annotate := flags.Bool("a", false, "annotate")
+  message := flags.String("m", "", "message")
+  force := flags.Bool("f", false, "force")
+  del := flags.Bool("d", false, "delete")
+  show := flags.Bool("show", false, "show")
+  flags.Parse(os.Args[2:])
+  args := flags.Args()
+
+  switch {
+  case *del:
+    if len(args) == 0 {
+      UsageTag()
+    }
+    for _, name := range(args) {
+      hash, err := core.GetTagRef(name)
+      if err != nil {
+        PrintAndExit(fmt.Sprintf("Tag '%s' not found.", name))
+      }
+      if err := core.DeleteTagRef(name); err != nil {
+        return err
+      }
+      fmt.Printf("Deleted tag '%s' (was %x)\n", name, hash[:4])
+    }
+  case *show:
+    if len(args) != 1 {
+      UsageTag()
+    }
+    hash, err := core.GetTagRef(args[0])
+    if err != nil {
+      PrintAndExit(fmt.Sprintf("Tag '%s' not found.", args[0]))
+    }
+    showObject(args[0], hash, showOptions{})
+  case *list || len(args) == 0:
+    for _, name := range(core.ListTags()) {
+      fmt.Println(name)
+    }
+  default:
+    if len(args) > 2 {
+      UsageTag()
+    }
+    name := args[0]
+    if !core.IsValidRefName(name) {
+      PrintAndExit(fmt.Sprintf("'%s' is not a valid tag name.", name))
+    }
+    rev := "HEAD"
+    if len(args) == 2 {
+      rev = args[1]
+    }
+    target := ResolveRevisionOrExit(rev)
+    if *annotate || *message != "" {
+      if *message == "" {
+        PrintAndExit("Annotated tags need a message, please use -m <msg>.")
+      }
+      tagger, err := core.GetCommitterIdent()
+      if err != nil {
+        PrintAndExit("Invalid tagger date: " + err.Error())
+      }
+      if target, err = core.CreateTagObject(target, name, tagger, *message); err != nil {
+        return err
+      }
+    }
+    if err := core.CreateTagRef(name, target, *force); err == core.ErrTagExists {
+      PrintAndExit(fmt.Sprintf("Tag '%s' already exists.", name))
+    } else if err != nil {
+      return err
+    }
+  }
+  return nil
+}
@@ -4,7 +4,9 @@ import (
   "fmt"
   "github.com/easonliao/flea/core"
   "os"
+  "path"
   "path/filepath"
+  "strings"
 )
 
 // Converts tree path to FS path relative to repository path.
@@ -39,3 +41,118 @@ func PrintAndExit(str string) {
   fmt.Println(str)
   os.Exit(1)
 }
+
+// Resolves the revision to the hash of an object, prints the error and exits if it fails.
+func ResolveRevisionOrExit(rev string) []byte {
+  hash, err := core.ResolveRevision(rev)
+  if err != nil {
+    PrintAndExit(revisionErrorString(rev, err))
+  }
+  return hash
+}
+
+// Resolves the revision to a commit, prints the error and exits if it fails.
+func ResolveCommitOrExit(rev string) (*core.Commit, []byte) {
+  commit, hash, err := core.ResolveCommit(rev)
+  if err != nil {
+    PrintAndExit(revisionErrorString(rev, err))
+  }
+  return commit, hash
+}
+
+func revisionErrorString(rev string, err error) string {
+  switch err {
+  case core.ErrUnknownRevision:
+    return fmt.Sprintf("Unknown revision: %s", rev)
+  case core.ErrNotCommit:
+    return fmt.Sprintf("%s doesn't point to a commit.", rev)
+  case core.ErrPathNotExist:
+    return fmt.Sprintf("Path doesn't exist in %s.", rev)
+  }
+  return err.Error()
+}
+
+// Gets the name of the branch HEAD points to, or the hash of the commit if HEAD is
+// detached. It's used to describe where HEAD was in reflog.
+func describeHead() string {
+  if branch, err := core.GetCurrentBranch(); err == nil {
+    return branch
+  }
+  if hash, err := core.GetHeadHash(); err == nil {
+    return fmt.Sprintf("%x", hash)
+  }
+  return ""
+}
+
+// Gets the name of current branch, or "detached HEAD" if HEAD is detached. It's used to
+// describe where new commits are created.
+func describeHeadShort() string {
+  if branch, err := core.GetCurrentBranch(); err == nil {
+    return branch
+  }
+  return "detached HEAD"
+}
+
+// Splits the arguments at the first "--", the arguments after it are always paths.
+func splitDashDash(args []string) (before, after []string, found bool) {
+  for i, arg := range(args) {
+    if arg == "--" {
+      return args[:i], args[i + 1:], true
+    }
+  }
+  return args, nil, false
+}
+
+// Parses the pathspec relative to current directory, prints the error and exits if it's
+// invalid.
+func ParsePathspecOrExit(patterns []string) *core.Pathspec {
+  ps, err := core.ParsePathspec(patterns, core.GetPathPrefix())
+  if err != nil {
+    PrintAndExit(fmt.Sprintf("Invalid pathspec: %s", strings.Join(patterns, " ")))
+  }
+  return ps
+}
+
+// Exits if any pattern of the pathspec doesn't match the paths.
+func ensurePathspecMatched(ps *core.Pathspec, paths []string) {
+  if unmatched := ps.Unmatched(paths); len(unmatched) > 0 {
+    PrintAndExit(fmt.Sprintf("Pathspec '%s' did not match any files.", unmatched[0]))
+  }
+}
+
+// Deletes the file from the index, the parent directories which become empty are also
+// deleted.
+func deleteFromIndex(treePath string) error {
+  idxTree := core.GetIndexTree()
+  if err := idxTree.Delete(treePath); err != nil {
+    return err
+  }
+  for dir := path.Dir(treePath); dir != "/"; dir = path.Dir(dir) {
+    node, err := idxTree.Get(dir)
+    if err != nil || len(node.GetChildren()) != 0 {
+      break
+    }
+    idxTree.Delete(dir)
+  }
+  return nil
+}
+
+// Deletes the file from working directory, the parent directories which become empty are
+// also deleted.
+func deleteFromWorkDir(treePath string) {
+  fullPath := filepath.Join(core.GetRepoDirectory(), TreePathToRelFsPath(treePath))
+  os.Remove(fullPath)
+  for dir := filepath.Dir(fullPath); dir != core.GetRepoDirectory(); dir = filepath.Dir(dir) {
+    if os.Remove(dir) != nil {
+      break
+    }
+  }
+}
+
+// Reads the content of the file node, either in working directory or in CAStore.
+func readNodeData(node core.Node) ([]byte, error) {
+  if _, ok := node.(*core.FsTreeNode); ok {
+    return node.GetData()
+  }
+  return core.GetCAStore().GetBlob(node.GetHashValue())
+}
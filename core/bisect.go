@@ -0,0 +1,202 @@
+package core
+
+import (
+  "bytes"
+  "encoding/hex"
+  "errors"
+  "strings"
+)
+
+var (
+  ErrNoBisect = errors.New("core: no bisect in progress")
+  ErrBisectNotReady = errors.New("core: need both a good and a bad commit")
+  ErrBisectBadIsGood = errors.New("core: the bad commit is an ancestor of a good commit")
+)
+
+// The state files of bisect in .flea directory.
+const (
+  // The content of the HEAD file before bisect started, it's restored by reset.
+  BisectStartFile = "BISECT_START"
+  // The bad commit.
+  BisectBadFile = "BISECT_BAD"
+  // The good commits, one per line.
+  BisectGoodFile = "BISECT_GOOD"
+  // The commits which can't be tested, one per line.
+  BisectSkipFile = "BISECT_SKIP"
+  // The log of the commands, it's shown by "bisect log".
+  BisectLogFile = "BISECT_LOG"
+)
+
+// The state of bisect, which finds the first bad commit between the good commits and the
+// bad commit by binary search.
+type Bisect struct {
+  // The content of the HEAD file before bisect started.
+  Start string
+  Bad []byte
+  Good [][]byte
+  Skip [][]byte
+}
+
+// The result of a step of bisect. Either Next is the commit to test, or FirstBad is the
+// first bad commit. If both are nil, the first bad commit can't be told because the
+// commits in Skipped were skipped.
+type BisectStep struct {
+  Next []byte
+  // The number of commits left to test after Next, and the rough number of steps.
+  Remaining int
+  Steps int
+  FirstBad []byte
+  Skipped [][]byte
+}
+
+// Checks whether there's a bisect in progress.
+func HasBisect() bool {
+  return HasStateFile(BisectStartFile)
+}
+
+// Starts a bisect, start is the content of the HEAD file to restore when it finishes.
+func StartBisect(start string) (*Bisect, error) {
+  bisect := &Bisect{Start : start}
+  if err := bisect.Save(); err != nil {
+    return nil, err
+  }
+  return bisect, WriteStateFile(BisectLogFile, []byte{})
+}
+
+// Loads the state of bisect, returns ErrNoBisect if there's none in progress.
+func LoadBisect() (*Bisect, error) {
+  start, err := ReadStateFile(BisectStartFile)
+  if err != nil {
+    return nil, ErrNoBisect
+  }
+  bisect := &Bisect{Start : string(start)}
+  if data, err := ReadStateFile(BisectBadFile); err == nil && len(data) > 0 {
+    if bisect.Bad, err = hex.DecodeString(string(data)); err != nil {
+      return nil, err
+    }
+  }
+  if bisect.Good, err = readHashList(BisectGoodFile); err != nil {
+    return nil, err
+  }
+  if bisect.Skip, err = readHashList(BisectSkipFile); err != nil {
+    return nil, err
+  }
+  return bisect, nil
+}
+
+// Saves the state of bisect.
+func (b *Bisect) Save() error {
+  if err := WriteStateFile(BisectStartFile, []byte(b.Start)); err != nil {
+    return err
+  }
+  if err := WriteStateFile(BisectBadFile, []byte(hex.EncodeToString(b.Bad))); err != nil {
+    return err
+  }
+  if err := writeHashList(BisectGoodFile, b.Good); err != nil {
+    return err
+  }
+  return writeHashList(BisectSkipFile, b.Skip)
+}
+
+// Removes all the state files of bisect.
+func RemoveBisect() {
+  for _, name := range([]string{BisectStartFile, BisectBadFile, BisectGoodFile,
+                                BisectSkipFile, BisectLogFile}) {
+    RemoveStateFile(name)
+  }
+}
+
+// Appends a line to the log of bisect.
+func AppendBisectLog(line string) error {
+  data, _ := ReadStateFile(BisectLogFile)
+  return WriteStateFile(BisectLogFile, append(data, []byte(line + "\n")...))
+}
+
+// Gets the log of bisect.
+func ReadBisectLog() string {
+  data, _ := ReadStateFile(BisectLogFile)
+  return string(data)
+}
+
+// Finds the next commit to test. The candidates are the commits reachable from the bad
+// commit but not from any good commit, the one which splits them into two halves is
+// picked. Skipped commits are never picked.
+func (b *Bisect) NextStep() (*BisectStep, error) {
+  if b.Bad == nil || len(b.Good) == 0 {
+    return nil, ErrBisectNotReady
+  }
+  candidates, err := WalkCommits([][]byte{b.Bad}, b.Good)
+  if err != nil {
+    return nil, err
+  }
+  if len(candidates) == 0 {
+    return nil, ErrBisectBadIsGood
+  }
+  // Commits have a single parent, so the candidates form a chain from the bad commit, and
+  // the candidate at i has len - i of them as its ancestors including itself.
+  n := len(candidates)
+  best, bestScore, unknown := -1, -1, 0
+  skipped := make([][]byte, 0)
+  for i := 1; i < n; i++ {
+    if containsHash(b.Skip, candidates[i]) {
+      skipped = append(skipped, candidates[i])
+      continue
+    }
+    unknown++
+    score := i
+    if n - i < score {
+      score = n - i
+    }
+    if score > bestScore {
+      best, bestScore = i, score
+    }
+  }
+  if best == -1 {
+    if len(skipped) > 0 {
+      return &BisectStep{Skipped : append(skipped, b.Bad)}, nil
+    }
+    return &BisectStep{FirstBad : b.Bad}, nil
+  }
+  step := &BisectStep{Next : candidates[best], Remaining : unknown / 2}
+  // Roughly log2 of the commits left.
+  for left := step.Remaining; left > 1; left /= 2 {
+    step.Steps++
+  }
+  return step, nil
+}
+
+func containsHash(hashs [][]byte, hash []byte) bool {
+  for _, h := range(hashs) {
+    if bytes.Equal(h, hash) {
+      return true
+    }
+  }
+  return false
+}
+
+func readHashList(name string) ([][]byte, error) {
+  hashs := make([][]byte, 0)
+  data, err := ReadStateFile(name)
+  if err != nil {
+    return hashs, nil
+  }
+  for _, line := range(strings.Split(string(data), "\n")) {
+    if line == "" {
+      continue
+    }
+    hash, err := hex.DecodeString(line)
+    if err != nil {
+      return nil, err
+    }
+    hashs = append(hashs, hash)
+  }
+  return hashs, nil
+}
+
+func writeHashList(name string, hashs [][]byte) error {
+  lines := make([]string, len(hashs))
+  for i, hash := range(hashs) {
+    lines[i] = hex.EncodeToString(hash)
+  }
+  return WriteStateFile(name, []byte(strings.Join(lines, "\n")))
+}
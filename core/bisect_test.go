@@ -0,0 +1,65 @@
+package core
+
+import (
+  "bytes"
+  "fmt"
+  "testing"
+)
+
+func TestBisect(t *testing.T) {
+  if _, err := initTestRepo("bisect_test"); err != nil {
+    t.Fatal(err)
+  }
+  commits := make([][]byte, 8)
+  for i := range(commits) {
+    content := []byte(fmt.Sprint(i))
+    commits[i], _ = commitTestFiles(map[string][]byte{"/a" : content}, fmt.Sprint("c", i))
+  }
+  bisect, err := StartBisect("ref:master")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if _, err := bisect.NextStep(); err != ErrBisectNotReady {
+    t.Error("Expecting ErrBisectNotReady")
+  }
+  bisect.Bad, bisect.Good = commits[7], [][]byte{commits[0]}
+  if err := bisect.Save(); err != nil {
+    t.Fatal(err)
+  }
+  if bisect, err = LoadBisect(); err != nil {
+    t.Fatal(err)
+  }
+  step, err := bisect.NextStep()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if !bytes.Equal(step.Next, commits[4]) || step.Remaining != 3 || step.Steps != 1 {
+    t.Errorf("Unexpected step %+v", step)
+  }
+
+  // c4 is bad, c2 is good and c3 is skipped, so c3 or c4 is the first bad commit.
+  bisect.Bad = commits[4]
+  bisect.Good = append(bisect.Good, commits[2])
+  bisect.Skip = [][]byte{commits[3]}
+  if step, _ = bisect.NextStep(); step.Next != nil || step.FirstBad != nil ||
+     len(step.Skipped) != 2 {
+    t.Errorf("Unexpected step %+v", step)
+  }
+  bisect.Skip = nil
+  if step, _ = bisect.NextStep(); !bytes.Equal(step.Next, commits[3]) {
+    t.Errorf("Expecting c3 to be tested, got %+v", step)
+  }
+  bisect.Good = append(bisect.Good, commits[3])
+  if step, _ = bisect.NextStep(); !bytes.Equal(step.FirstBad, commits[4]) {
+    t.Errorf("Expecting c4 to be the first bad commit, got %+v", step)
+  }
+
+  bisect.Good = [][]byte{commits[5]}
+  if _, err := bisect.NextStep(); err != ErrBisectBadIsGood {
+    t.Error("Expecting ErrBisectBadIsGood")
+  }
+  RemoveBisect()
+  if HasBisect() {
+    t.Error("Bisect should be removed")
+  }
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+  "bytes"
+)
+
+// The origin of a line of the blamed file. Commit is the hash of the commit which added
+// the line, OrigLine is the 1-based number of the line in the file of that commit, and
+// Line is the 1-based number of the line in the blamed file.
+type BlameLine struct {
+  Commit []byte
+  OrigLine int
+  Line int
+  Text string
+}
+
+// Finds the commit which added each line of the file at treePath in the commit. It walks
+// back the history and diffs the file between each commit and its parent, the lines which
+// are not in the parent are added by the commit. Renames are not followed.
+func Blame(commitHash []byte, treePath string) ([]BlameLine, error) {
+  commit, err := GetCommitObject(commitHash)
+  if err != nil {
+    return nil, err
+  }
+  node, err := commit.GetCATree().Get(treePath)
+  if err != nil {
+    return nil, err
+  }
+  if node.IsDir() {
+    return nil, ErrNotFile
+  }
+  data, err := node.GetData()
+  if err != nil {
+    return nil, err
+  }
+  lines := SplitLines(data)
+  result := make([]BlameLine, len(lines))
+  // Maps the lines of the blamed file which haven't been attributed yet to their 0-based
+  // index in the file of current commit.
+  pending := make(map[int]int, len(lines))
+  for i, line := range(lines) {
+    result[i] = BlameLine{Line : i + 1, Text : line}
+    pending[i] = i
+  }
+  hash := commitHash
+  for len(pending) > 0 {
+    var parentNode Node
+    parentHash := commit.PrevCommit
+    if parentHash != nil {
+      parent, err := GetCommitObject(parentHash)
+      if err != nil {
+        return nil, err
+      }
+      if parentNode, err = parent.GetCATree().Get(treePath); err != nil || parentNode.IsDir() {
+        parentNode = nil
+      }
+      commit = parent
+    }
+    if parentNode == nil {
+      // The file is added by current commit, it takes all the remaining lines.
+      for i, pos := range(pending) {
+        result[i].Commit, result[i].OrigLine = hash, pos + 1
+      }
+      break
+    }
+    if !bytes.Equal(parentNode.GetHashValue(), node.GetHashValue()) {
+      parentData, err := parentNode.GetData()
+      if err != nil {
+        return nil, err
+      }
+      // Maps the lines of current file which also exist in the parent.
+      toParent := make(map[int]int)
+      for _, op := range(DiffLines(SplitLines(parentData), lines)) {
+        if op.Kind == DiffEqual {
+          toParent[op.BLine] = op.ALine
+        }
+      }
+      for i, pos := range(pending) {
+        if parentPos, ok := toParent[pos]; ok {
+          pending[i] = parentPos
+        } else {
+          result[i].Commit, result[i].OrigLine = hash, pos + 1
+          delete(pending, i)
+        }
+      }
+      lines = SplitLines(parentData)
+    }
+    node, hash = parentNode, parentHash
+  }
+  return result, nil
+}
@@ -0,0 +1,41 @@
+package core
+
+import (
+  "bytes"
+  "testing"
+)
+
+func TestBlame(t *testing.T) {
+  if _, err := initTestRepo("blame_test"); err != nil {
+    t.Fatal(err)
+  }
+  c1, _ := commitTestFiles(map[string][]byte{"/f" : []byte("a\nb\nc\n")}, "c1")
+  c2, _ := commitTestFiles(map[string][]byte{"/g" : []byte("g\n")}, "c2")
+  c3, _ := commitTestFiles(map[string][]byte{"/f" : []byte("a\nx\nb\nc\ny\n")}, "c3")
+  c4, _ := commitTestFiles(map[string][]byte{"/f" : []byte("a\nx\nc\ny\nz\n")}, "c4")
+
+  lines, err := Blame(c4, "/f")
+  if err != nil {
+    t.Fatal(err)
+  }
+  expected := []struct {
+    commit []byte
+    origLine int
+    text string
+  }{{c1, 1, "a\n"}, {c3, 2, "x\n"}, {c1, 3, "c\n"}, {c3, 5, "y\n"}, {c4, 5, "z\n"}}
+  if len(lines) != len(expected) {
+    t.Fatal("Unexpected number of lines", len(lines))
+  }
+  for i, line := range(lines) {
+    if !bytes.Equal(line.Commit, expected[i].commit) || line.OrigLine != expected[i].origLine ||
+       line.Line != i + 1 || line.Text != expected[i].text {
+      t.Errorf("Unexpected blame of line %d: %+v", i + 1, line)
+    }
+  }
+  if lines, _ := Blame(c2, "/g"); len(lines) != 1 || !bytes.Equal(lines[0].Commit, c2) {
+    t.Error("Expecting g to be added by c2")
+  }
+  if _, err := Blame(c4, "/nope"); err != ErrPathNotExist {
+    t.Error("Expecting ErrPathNotExist")
+  }
+}
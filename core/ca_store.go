@@ -25,6 +25,7 @@ const (
   BlobType = "blob"
   TreeType = "tree"
   CommitType = "commit"
+  TagType = "tag"
 )
 
 // The length of hash value.
@@ -78,12 +79,28 @@ func (store *CAStore) StoreCommit(data []byte) ([]byte, error) {
   return hash[:], nil
 }
 
+// Stores tag data to content-addressable store.
+func (store *CAStore) StoreTag(data []byte) ([]byte, error) {
+  hash, blob, err := WrapData(TagType, data)
+  if err != nil {
+    return nil, err
+  }
+  fileName := hex.EncodeToString(hash[:])
+  store.write(fileName, blob)
+  return hash[:], nil
+}
+
 // Gets a list of full hashs that match the prefix of the hash value. The return values can be:
 // 1) a list of hashs, nil
 // 2) undefined, ErrNotValidHash
 func (store *CAStore) GetMatchedHashs(hashPrefix []byte) (hashs [][]byte) {
+  return store.GetMatchedHashsByString(hex.EncodeToString(hashPrefix))
+}
+
+// Same as GetMatchedHashs, but the prefix is a hex string so it can have odd length.
+func (store *CAStore) GetMatchedHashsByString(hashString string) (hashs [][]byte) {
   hashs = make([][]byte, 0, 1)
-  hashString := hex.EncodeToString(hashPrefix)
+  hashString = strings.ToLower(hashString)
   walkFun := func(path string, info os.FileInfo, err error) error {
     if info.IsDir() && path != store.dir {
       return filepath.SkipDir
@@ -115,12 +132,12 @@ func (store* CAStore) Get(hash []byte) (fileType string, data []byte, err error)
     fileType = headers[0]
     length, err := strconv.Atoi(headers[1])
     if err != nil {
-      fmt.Println("Failed to conver %s to integer.", headers[1])
+      fmt.Printf("Failed to conver %s to integer.\n", headers[1])
       os.Exit(1)
     }
     // Sanity check, length field must match the actual length of data.
     if length != len(data) {
-      fmt.Println("The length is not correct, %s is invalid file", fileName)
+      fmt.Printf("The length is not correct, %s is invalid file\n", fileName)
       os.Exit(1)
     }
   } else {
@@ -129,6 +146,19 @@ func (store* CAStore) Get(hash []byte) (fileType string, data []byte, err error)
   return
 }
 
+// Gets the data of the blob with the given hash. Returns ErrNotFile if the hash doesn't
+// point to a blob.
+func (store *CAStore) GetBlob(hash []byte) ([]byte, error) {
+  fType, data, err := store.Get(hash)
+  if err != nil {
+    return nil, err
+  }
+  if fType != BlobType {
+    return nil, ErrNotFile
+  }
+  return data, nil
+}
+
 // Given a hash value, returns true if a file with the given hash exists in store.
 func (store *CAStore) Exists(hash []byte) bool {
   fileName := hex.EncodeToString(hash)
@@ -153,7 +183,8 @@ func (store *CAStore) write(fileName string, data []byte) {
 }
 
 func WrapData(fileType string, data []byte) (hash [HashSize]byte, blob []byte, err error) {
-  if fileType != BlobType && fileType != TreeType && fileType != CommitType {
+  if fileType != BlobType && fileType != TreeType && fileType != CommitType &&
+     fileType != TagType {
     err =  ErrInvalidType
     return
   }
@@ -1,7 +1,6 @@
 package core
 
 import (
-  "encoding/hex"
   "log"
   "strings"
 )
@@ -14,6 +13,8 @@ type CATree struct {
 // The node of CATree.
 type CANode struct {
   hash  []byte
+  // The mode recorded by the parent directory, it's 0 for the root node.
+  mode FileMode
   children map[string]Node
 }
 
@@ -75,6 +76,9 @@ func (node *CANode) GetHashValue() []byte {
 
 // See Node interface.
 func (node *CANode) IsDir() bool {
+  if node.mode != 0 {
+    return node.mode == ModeDir
+  }
   fType, _, err := GetCAStore().Get(node.GetHashValue())
   if err != nil {
     log.Fatal(err.Error())
@@ -82,6 +86,17 @@ func (node *CANode) IsDir() bool {
   return fType == TreeType
 }
 
+// See Node interface.
+func (node *CANode) GetMode() FileMode {
+  if node.mode != 0 {
+    return node.mode
+  }
+  if node.IsDir() {
+    return ModeDir
+  }
+  return ModeRegular
+}
+
 // See Node interface.
 func (node *CANode) String() string {
   return String(node)
@@ -111,24 +126,13 @@ func (node *CANode) GetChildren() map[string]Node {
   if fType !=  TreeType {
     log.Fatal(ErrNotFile.Error())
   }
-  if len(data) == 0 {
-    // It's possible the directory is empty.
-    return make(map[string]Node)
+  entries, err := ParseDirString(data)
+  if err != nil {
+    log.Fatal(err)
   }
   children := make(map[string]Node)
-  dirString := string(data)
-  rows := strings.Split(dirString, "\n")
-  for _, row  := range(rows) {
-    entries := strings.Split(row, " ")
-    if len(entries) != 3 {
-      log.Fatal("The number of entries per row is incorrect")
-    }
-    name := entries[2]
-    hash, err := hex.DecodeString(entries[1])
-    if err != nil {
-      log.Fatal(err)
-    }
-    children[name] = newCANode(hash)
+  for _, entry := range(entries) {
+    children[entry.Name] = &CANode{hash : entry.Hash, mode : entry.Mode}
   }
   // Caches the children.
   node.children = children
@@ -5,6 +5,8 @@ import (
   "encoding/json"
   "errors"
   "log"
+  "strings"
+  "time"
 )
 
 var (
@@ -12,12 +14,32 @@ var (
   ErrFileNotInCaStore = errors.New("core: file is not in CAStore")
 )
 
-// Commit object.
+// Commit object. The fields after Comment were added later, they are omitted when
+// empty so commits created before them still decode and hash to the same value.
 type Commit struct {
-  Tree        []byte  `json:tree`
-  PrevCommit  []byte  `json:prev`
-  Author      string  `json:author`
-  Comment     string  `json:comment`
+  Tree            []byte
+  PrevCommit      []byte
+  Author          string
+  Comment         string
+  AuthorEmail     string  `json:",omitempty"`
+  AuthorDate      string  `json:",omitempty"`
+  Committer       string  `json:",omitempty"`
+  CommitterEmail  string  `json:",omitempty"`
+  CommitterDate   string  `json:",omitempty"`
+}
+
+// Gets the author of the commit. The time is zero for commits which don't record it.
+func (c *Commit) GetAuthor() Signature {
+  return Signature{c.Author, c.AuthorEmail, parseStoredDate(c.AuthorDate)}
+}
+
+// Gets the committer of the commit. Commits which don't record the committer fall back
+// to the author.
+func (c *Commit) GetCommitter() Signature {
+  if c.Committer == "" {
+    return c.GetAuthor()
+  }
+  return Signature{c.Committer, c.CommitterEmail, parseStoredDate(c.CommitterDate)}
 }
 
 // Gets the ancestor commit of this commit object, returns nil if there's no ancestor.
@@ -50,6 +72,15 @@ func (c* Commit) GetCommitHash() []byte {
   return hash[:]
 }
 
+// Gets the first line of the message, used as the subject of commits.
+func FirstLine(message string) string {
+  message = strings.TrimSpace(message)
+  if idx := strings.Index(message, "\n"); idx != -1 {
+    return message[:idx]
+  }
+  return message
+}
+
 // Gets the CATree of this commit.
 func (c* Commit) GetCATree() Tree {
   return GetCATree(c.Tree)
@@ -74,8 +105,19 @@ func GetCommitObject(hash []byte) (*Commit, error) {
 }
 
 // Creates a commit object in CAStore.
-func CreateCommitObject(tree, prevCommit []byte, author, comment string) ([]byte, error) {
-  commit := Commit{tree, prevCommit, author, comment}
+func CreateCommitObject(tree, prevCommit []byte, author, committer Signature,
+                        comment string) ([]byte, error) {
+  commit := Commit{
+    Tree : tree,
+    PrevCommit : prevCommit,
+    Author : author.Name,
+    Comment : comment,
+    AuthorEmail : author.Email,
+    AuthorDate : FormatDate(author.When),
+    Committer : committer.Name,
+    CommitterEmail : committer.Email,
+    CommitterDate : FormatDate(committer.When),
+  }
   store := GetCAStore()
   if !store.Exists(tree) {
     log.Fatal("Invalid tree hash.")
@@ -92,7 +134,12 @@ func CreateCommitObject(tree, prevCommit []byte, author, comment string) ([]byte
 
 // Builds a CATree from the staging area.
 func BuildCATreeFromIndexFile() (*CATree, error) {
-  idxTree := GetIndexTree()
+  return BuildCATree(GetIndexTree())
+}
+
+// Stores all the directories of the tree to CAStore and returns the CATree of it, the
+// files must have been stored already.
+func BuildCATree(idxTree Tree) (*CATree, error) {
   caStore := GetCAStore()
   var rootHash []byte
 
@@ -113,8 +160,9 @@ func BuildCATreeFromIndexFile() (*CATree, error) {
         // by index tree.
         panic("The hash value of dir node doens't match returned by ca store")
       }
-    } else {
-      // The node is file, verifies it's in CAStore.
+    } else if node.GetMode() != ModeGitlink {
+      // The node is file, verifies it's in CAStore. Gitlinks point to commits of other
+      // repositories so they are not in CAStore.
       if !caStore.Exists(node.GetHashValue()) {
         return ErrFileNotInCaStore
       }
@@ -132,6 +180,17 @@ func BuildCATreeFromIndexFile() (*CATree, error) {
   return GetCATree(rootHash), nil
 }
 
+func parseStoredDate(date string) time.Time {
+  if date == "" {
+    return time.Time{}
+  }
+  t, err := time.Parse(time.RFC3339, date)
+  if err != nil {
+    return time.Time{}
+  }
+  return t
+}
+
 func fromCommitObjectToBytes(commit *Commit) ([]byte, error) {
   return json.Marshal(commit)
 }
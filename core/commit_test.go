@@ -0,0 +1,70 @@
+package core
+
+import (
+  "bytes"
+  "testing"
+  "time"
+)
+
+func TestLegacyCommitObject(t *testing.T) {
+  // A commit object created before author email, dates and committer were recorded.
+  legacy := []byte(`{"Tree":"AAECAwQFBgcICQoLDA0ODxAREhM=","PrevCommit":null,"Author":"eason","Comment":"init"}`)
+  commit, err := fromBytesToCommitObject(legacy)
+  if err != nil {
+    t.Fatal("Failed to decode legacy commit:", err)
+  }
+  if commit.Author != "eason" || commit.Comment != "init" {
+    t.Error("Fields of legacy commit are not decoded correctly")
+  }
+  if !commit.GetAuthor().When.IsZero() {
+    t.Error("Legacy commit shouldn't have author date")
+  }
+  if commit.GetCommitter().Name != "eason" {
+    t.Error("Committer of legacy commit should fall back to author")
+  }
+  // Encoding it again must give the same bytes, otherwise its hash changes.
+  data, _ := fromCommitObjectToBytes(commit)
+  if bytes.Compare(data, legacy) != 0 {
+    t.Errorf("Legacy commit is not encoded to the same bytes: %s", data)
+  }
+}
+
+func TestCommitSignatures(t *testing.T) {
+  when, err := ParseDate("1700000000 +0130")
+  if err != nil {
+    t.Fatal("Failed to parse date:", err)
+  }
+  commit := &Commit{
+    Author : "Foo",
+    AuthorEmail : "foo@example.com",
+    AuthorDate : FormatDate(when),
+  }
+  data, _ := fromCommitObjectToBytes(commit)
+  decoded, _ := fromBytesToCommitObject(data)
+  author := decoded.GetAuthor()
+  if author.String() != "Foo <foo@example.com>" {
+    t.Error("Incorrect author:", author)
+  }
+  if !author.When.Equal(when) {
+    t.Error("Incorrect author date:", author.When)
+  }
+  if _, offset := author.When.Zone(); offset != 90 * 60 {
+    t.Error("Time zone of author date is not preserved")
+  }
+  if _, err := ParseIdent("no email"); err != ErrInvalidIdent {
+    t.Error("Expecting ErrInvalidIdent")
+  }
+  if _, err := ParseDate("2020-01-02"); err != nil {
+    t.Error("Failed to parse date:", err)
+  }
+  if d, _ := ParseDate("2020-01-02 03:04:05 +0200"); d.UTC() != time.Date(2020, 1, 2, 1, 4, 5, 0, time.UTC) {
+    t.Error("Incorrect date:", d)
+  }
+  if d, err := ParseDate("2 weeks ago"); err != nil || time.Since(d) < 13 * 24 * time.Hour ||
+     time.Since(d) > 15 * 24 * time.Hour {
+    t.Error("Incorrect relative date:", d, err)
+  }
+  if _, err := ParseDate("2 fortnights ago"); err != ErrInvalidDate {
+    t.Error("Expecting ErrInvalidDate")
+  }
+}
@@ -0,0 +1,530 @@
+package core
+
+import (
+  "bufio"
+  "bytes"
+  "errors"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
+)
+
+var (
+  ErrInvalidConfigKey = errors.New("core: invalid config key, expecting section.name")
+  ErrConfigSyntax = errors.New("core: syntax error in config file")
+  ErrConfigKeyNotFound = errors.New("core: config key not found")
+  ErrInvalidConfigValue = errors.New("core: invalid config value")
+)
+
+// The scope of a config file. Files of higher scopes override the lower ones.
+type ConfigScope int
+
+const (
+  ConfigSystem ConfigScope = iota
+  ConfigGlobal
+  ConfigLocal
+)
+
+// Converts the scope to readable string.
+func (scope ConfigScope) String() string {
+  switch scope {
+  case ConfigSystem:
+    return "system"
+  case ConfigGlobal:
+    return "global"
+  default:
+    return "local"
+  }
+}
+
+// A single key/value pair in config.
+type ConfigEntry struct {
+  Key string
+  Value string
+  Scope ConfigScope
+}
+
+// Config is the merged view of the system, global(user) and local(repository) config
+// files.
+type Config struct {
+  files [3]*ConfigFile
+}
+
+// Merged config is singleton object.
+var config *Config = nil
+
+// Gets the merged config. The local config is only included if the core package has
+// been initialized with a repository.
+func GetConfig() *Config {
+  if config == nil {
+    config = &Config{}
+    for _, scope := range([]ConfigScope{ConfigSystem, ConfigGlobal, ConfigLocal}) {
+      path := GetConfigPath(scope)
+      if path == "" {
+        continue
+      }
+      file, err := LoadConfigFile(path)
+      if err != nil {
+        // Broken config files are ignored so they won't block every command.
+        continue
+      }
+      config.files[scope] = file
+    }
+  }
+  return config
+}
+
+// Gets the path of the config file of the given scope. The system and global config can
+// be relocated by FLEA_CONFIG_SYSTEM and FLEA_CONFIG_GLOBAL environment variables. It
+// returns an empty string if the path can't be decided.
+func GetConfigPath(scope ConfigScope) string {
+  switch scope {
+  case ConfigSystem:
+    if path := os.Getenv("FLEA_CONFIG_SYSTEM"); path != "" {
+      return path
+    }
+    return "/etc/fleaconfig"
+  case ConfigGlobal:
+    if path := os.Getenv("FLEA_CONFIG_GLOBAL"); path != "" {
+      return path
+    }
+    if home, err := os.UserHomeDir(); err == nil {
+      return filepath.Join(home, ".fleaconfig")
+    }
+    return ""
+  default:
+    if !initialized {
+      return ""
+    }
+    return filepath.Join(GetFleaDirectory(), "config")
+  }
+}
+
+// Gets the value of the key, the value in local config overrides the value in global
+// config, which overrides the value in system config.
+func (c *Config) Get(key string) (string, bool) {
+  for scope := ConfigLocal; scope >= ConfigSystem; scope-- {
+    if c.files[scope] == nil {
+      continue
+    }
+    if value, ok := c.files[scope].Get(key); ok {
+      return value, true
+    }
+  }
+  return "", false
+}
+
+// Gets the string value of the key, or def if the key doesn't exist.
+func (c *Config) GetString(key, def string) string {
+  if value, ok := c.Get(key); ok {
+    return value
+  }
+  return def
+}
+
+// Gets the boolean value of the key, or def if the key doesn't exist.
+func (c *Config) GetBool(key string, def bool) (bool, error) {
+  if value, ok := c.Get(key); ok {
+    return parseConfigBool(value)
+  }
+  return def, nil
+}
+
+// Gets the integer value of the key, or def if the key doesn't exist. The value can have
+// a k, m or g suffix.
+func (c *Config) GetInt(key string, def int) (int, error) {
+  if value, ok := c.Get(key); ok {
+    return parseConfigInt(value)
+  }
+  return def, nil
+}
+
+// Lists all the entries of all the config files, entries of lower scopes come first.
+func (c *Config) List() []ConfigEntry {
+  entries := make([]ConfigEntry, 0)
+  for scope := ConfigSystem; scope <= ConfigLocal; scope++ {
+    if c.files[scope] == nil {
+      continue
+    }
+    for _, entry := range(c.files[scope].Entries()) {
+      entry.Scope = scope
+      entries = append(entries, entry)
+    }
+  }
+  return entries
+}
+
+// Sets the key to value in the config file of the given scope.
+func (c *Config) Set(scope ConfigScope, key, value string) error {
+  file, err := c.getFile(scope)
+  if err != nil {
+    return err
+  }
+  if err = file.Set(key, value); err != nil {
+    return err
+  }
+  return file.Save()
+}
+
+// Removes the key from the config file of the given scope.
+func (c *Config) Unset(scope ConfigScope, key string) error {
+  file, err := c.getFile(scope)
+  if err != nil {
+    return err
+  }
+  if err = file.Unset(key); err != nil {
+    return err
+  }
+  return file.Save()
+}
+
+func (c *Config) getFile(scope ConfigScope) (*ConfigFile, error) {
+  if c.files[scope] == nil {
+    path := GetConfigPath(scope)
+    if path == "" {
+      return nil, ErrNoFleaDir
+    }
+    file, err := LoadConfigFile(path)
+    if err != nil {
+      return nil, err
+    }
+    c.files[scope] = file
+  }
+  return c.files[scope], nil
+}
+
+// ConfigFile is a single INI-style config file. It keeps the lines of the file so
+// comments and formatting survive Set and Unset.
+//
+//   # comment
+//   [user]
+//     name = Eason Liao
+//   [branch "master"]
+//     description = "the main line"
+//
+// Section and key names are case-insensitive, subsection names are case-sensitive.
+type ConfigFile struct {
+  path string
+  lines []configLine
+}
+
+type configLine struct {
+  raw string
+  // The section of the line in the form of "section" or "section.subsection".
+  section string
+  // The key name if the line is an entry, empty otherwise.
+  key string
+  value string
+  // Whether the line is a section header.
+  header bool
+}
+
+// Loads the config file, a file which doesn't exist is treated as an empty file. Other
+// read errors are returned so the file won't be overwritten as an empty one.
+func LoadConfigFile(path string) (*ConfigFile, error) {
+  file := &ConfigFile{path : path, lines : make([]configLine, 0)}
+  data, err := ioutil.ReadFile(path)
+  if os.IsNotExist(err) {
+    return file, nil
+  }
+  if err != nil {
+    return nil, err
+  }
+  if err := file.parse(data); err != nil {
+    return nil, err
+  }
+  return file, nil
+}
+
+// Gets the value of the key, the last one wins if the key appears more than once.
+func (f *ConfigFile) Get(key string) (string, bool) {
+  section, name, err := splitConfigKey(key)
+  if err != nil {
+    return "", false
+  }
+  value, found := "", false
+  for _, line := range(f.lines) {
+    if line.key != "" && line.section == section && line.key == name {
+      value, found = line.value, true
+    }
+  }
+  return value, found
+}
+
+// Gets all the entries of the file in order.
+func (f *ConfigFile) Entries() []ConfigEntry {
+  entries := make([]ConfigEntry, 0)
+  for _, line := range(f.lines) {
+    if line.key != "" {
+      entries = append(entries, ConfigEntry{Key : line.section + "." + line.key, Value : line.value})
+    }
+  }
+  return entries
+}
+
+// Sets the key to value. The last existing entry is updated in place, otherwise the
+// entry is appended to the section, which is created if it doesn't exist.
+func (f *ConfigFile) Set(key, value string) error {
+  section, name, err := splitConfigKey(key)
+  if err != nil {
+    return err
+  }
+  entry := configLine{
+    raw : "\t" + name + " = " + quoteConfigValue(value),
+    section : section,
+    key : name,
+    value : value,
+  }
+  lastInSection := -1
+  for i := len(f.lines) - 1; i >= 0; i-- {
+    line := f.lines[i]
+    if line.section != section {
+      continue
+    }
+    if line.key == name {
+      f.lines[i] = entry
+      return nil
+    }
+    if lastInSection == -1 && (line.key != "" || line.header) {
+      lastInSection = i
+    }
+  }
+  if lastInSection == -1 {
+    header := configLine{raw : sectionHeader(section), section : section, header : true}
+    f.lines = append(f.lines, header)
+    f.lines = append(f.lines, entry)
+    return nil
+  }
+  f.lines = append(f.lines, configLine{})
+  copy(f.lines[lastInSection + 2:], f.lines[lastInSection + 1:])
+  f.lines[lastInSection + 1] = entry
+  return nil
+}
+
+// Removes all the entries of the key. Returns ErrConfigKeyNotFound if there's no such key.
+func (f *ConfigFile) Unset(key string) error {
+  section, name, err := splitConfigKey(key)
+  if err != nil {
+    return err
+  }
+  lines := make([]configLine, 0, len(f.lines))
+  for _, line := range(f.lines) {
+    if line.key == "" || line.section != section || line.key != name {
+      lines = append(lines, line)
+    }
+  }
+  if len(lines) == len(f.lines) {
+    return ErrConfigKeyNotFound
+  }
+  f.lines = lines
+  return nil
+}
+
+// Writes the file back to disk.
+func (f *ConfigFile) Save() error {
+  var buffer bytes.Buffer
+  for _, line := range(f.lines) {
+    buffer.WriteString(line.raw)
+    buffer.WriteByte('\n')
+  }
+  if err := os.MkdirAll(filepath.Dir(f.path), 0777); err != nil {
+    return err
+  }
+  return write(f.path, buffer.Bytes())
+}
+
+func (f *ConfigFile) parse(data []byte) error {
+  section := ""
+  scanner := bufio.NewScanner(bytes.NewReader(data))
+  for scanner.Scan() {
+    raw := scanner.Text()
+    line := configLine{raw : raw}
+    text := strings.TrimSpace(raw)
+    switch {
+    case text == "" || text[0] == '#' || text[0] == ';':
+      line.section = section
+    case text[0] == '[':
+      end := strings.Index(text, "]")
+      if end == -1 {
+        return ErrConfigSyntax
+      }
+      var err error
+      if section, err = parseSectionHeader(text[1:end]); err != nil {
+        return err
+      }
+      line.section, line.header = section, true
+    default:
+      name, value := text, "true"
+      if eq := strings.Index(text, "="); eq != -1 {
+        var err error
+        name = strings.TrimSpace(text[:eq])
+        if value, err = parseConfigValue(text[eq + 1:]); err != nil {
+          return err
+        }
+      }
+      if section == "" || !isValidConfigName(name) {
+        return ErrConfigSyntax
+      }
+      line.section, line.key, line.value = section, strings.ToLower(name), value
+    }
+    f.lines = append(f.lines, line)
+  }
+  return scanner.Err()
+}
+
+// Parses the inside of a section header, e.g. `alias "co"` to "alias.co".
+func parseSectionHeader(header string) (string, error) {
+  header = strings.TrimSpace(header)
+  if sp := strings.IndexAny(header, " \t"); sp != -1 {
+    name := strings.ToLower(header[:sp])
+    sub := strings.TrimSpace(header[sp:])
+    if len(sub) < 2 || sub[0] != '"' || sub[len(sub) - 1] != '"' || !isValidConfigName(name) {
+      return "", ErrConfigSyntax
+    }
+    sub = strings.Replace(sub[1:len(sub) - 1], `\"`, `"`, -1)
+    return name + "." + strings.Replace(sub, `\\`, `\`, -1), nil
+  }
+  if !isValidConfigName(header) {
+    return "", ErrConfigSyntax
+  }
+  return strings.ToLower(header), nil
+}
+
+func sectionHeader(section string) string {
+  if dot := strings.Index(section, "."); dot != -1 {
+    sub := strings.Replace(section[dot + 1:], `\`, `\\`, -1)
+    return "[" + section[:dot] + " \"" + strings.Replace(sub, `"`, `\"`, -1) + "\"]"
+  }
+  return "[" + section + "]"
+}
+
+// Parses the value part of an entry: strips the comment and surrounding whitespace,
+// removes quotes and handles escape sequences.
+func parseConfigValue(raw string) (string, error) {
+  var buffer bytes.Buffer
+  inQuote := false
+  // Number of bytes in buffer which must be kept even if they are trailing spaces.
+  keep := 0
+  raw = strings.TrimSpace(raw)
+  for i := 0; i < len(raw); i++ {
+    c := raw[i]
+    switch {
+    case c == '"':
+      inQuote = !inQuote
+      keep = buffer.Len()
+    case c == '\\':
+      if i + 1 == len(raw) {
+        return "", ErrConfigSyntax
+      }
+      i++
+      switch raw[i] {
+      case 'n':
+        buffer.WriteByte('\n')
+      case 't':
+        buffer.WriteByte('\t')
+      case '"', '\\':
+        buffer.WriteByte(raw[i])
+      default:
+        return "", ErrConfigSyntax
+      }
+      keep = buffer.Len()
+    case (c == '#' || c == ';') && !inQuote:
+      i = len(raw)
+    default:
+      buffer.WriteByte(c)
+      if inQuote {
+        keep = buffer.Len()
+      }
+    }
+  }
+  if inQuote {
+    return "", ErrConfigSyntax
+  }
+  value := buffer.String()
+  trimmed := strings.TrimRight(value, " \t")
+  if len(trimmed) < keep {
+    trimmed = value[:keep]
+  }
+  return trimmed, nil
+}
+
+// Quotes the value if it can't be written as it is.
+func quoteConfigValue(value string) string {
+  needQuote := value != strings.TrimSpace(value) || strings.ContainsAny(value, "#;")
+  value = strings.Replace(value, `\`, `\\`, -1)
+  value = strings.Replace(value, `"`, `\"`, -1)
+  value = strings.Replace(value, "\n", `\n`, -1)
+  value = strings.Replace(value, "\t", `\t`, -1)
+  if needQuote {
+    return `"` + value + `"`
+  }
+  return value
+}
+
+// Splits key "section.subsection.name" to "section.subsection" and "name". Section and
+// name are lowercased.
+func splitConfigKey(key string) (section, name string, err error) {
+  first := strings.Index(key, ".")
+  last := strings.LastIndex(key, ".")
+  if first <= 0 || last == len(key) - 1 {
+    err = ErrInvalidConfigKey
+    return
+  }
+  name = strings.ToLower(key[last + 1:])
+  if first == last {
+    section = strings.ToLower(key[:first])
+  } else {
+    section = strings.ToLower(key[:first]) + key[first:last]
+  }
+  if !isValidConfigName(name) || !isValidConfigName(key[:first]) {
+    err = ErrInvalidConfigKey
+  }
+  return
+}
+
+func isValidConfigName(name string) bool {
+  if name == "" {
+    return false
+  }
+  for _, c := range(name) {
+    if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+      return false
+    }
+  }
+  return true
+}
+
+func parseConfigBool(value string) (bool, error) {
+  switch strings.ToLower(value) {
+  case "true", "yes", "on", "1":
+    return true, nil
+  case "false", "no", "off", "0", "":
+    return false, nil
+  }
+  return false, ErrInvalidConfigValue
+}
+
+func parseConfigInt(value string) (int, error) {
+  value = strings.TrimSpace(value)
+  multiplier := 1
+  if n := len(value); n > 0 {
+    switch value[n - 1] {
+    case 'k', 'K':
+      multiplier = 1 << 10
+    case 'm', 'M':
+      multiplier = 1 << 20
+    case 'g', 'G':
+      multiplier = 1 << 30
+    }
+    if multiplier != 1 {
+      value = value[:n - 1]
+    }
+  }
+  n, err := strconv.Atoi(value)
+  if err != nil {
+    return 0, ErrInvalidConfigValue
+  }
+  return n * multiplier, nil
+}
@@ -0,0 +1,87 @@
+package core
+
+import (
+  "io/ioutil"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+var configContent = `# comment
+[user]
+	name = Eason Liao ; trailing comment
+	email = "eason@example.com"
+[core]
+	bare
+	bigFileThreshold = 512k
+[branch "Master"]
+	description = "line1\nline2"
+`
+
+func TestConfigFile(t *testing.T) {
+  dir, _ := mkDir("config_test")
+  path := filepath.Join(dir, "config")
+  ioutil.WriteFile(path, []byte(configContent), 0666)
+  file, err := LoadConfigFile(path)
+  if err != nil {
+    t.Fatal("Failed to load config:", err)
+  }
+  expected := map[string]string {
+    "user.name" : "Eason Liao",
+    "USER.Email" : "eason@example.com",
+    "core.bare" : "true",
+    "branch.Master.description" : "line1\nline2",
+  }
+  for key, value := range(expected) {
+    if v, ok := file.Get(key); !ok || v != value {
+      t.Errorf("Expecting %q for %s, got %q", value, key, v)
+    }
+  }
+  if _, ok := file.Get("branch.master.description"); ok {
+    t.Error("Subsection names should be case-sensitive")
+  }
+  if n, _ := parseConfigInt("512k"); n != 512 * 1024 {
+    t.Error("Incorrect integer value", n)
+  }
+
+  file.Set("user.name", "Foo")
+  file.Set("core.editor", "vim -f")
+  file.Set("alias.co", "checkout")
+  if err := file.Unset("core.bare"); err != nil {
+    t.Error("Failed to unset core.bare")
+  }
+  if err := file.Unset("core.bare"); err != ErrConfigKeyNotFound {
+    t.Error("Expecting ErrConfigKeyNotFound")
+  }
+  if err := file.Set("nosection", "x"); err != ErrInvalidConfigKey {
+    t.Error("Expecting ErrInvalidConfigKey")
+  }
+  file.Save()
+
+  data, _ := ioutil.ReadFile(path)
+  if !strings.HasPrefix(string(data), "# comment\n") {
+    t.Error("Comments should be kept")
+  }
+  file, _ = LoadConfigFile(path)
+  expected = map[string]string {
+    "user.name" : "Foo",
+    "core.editor" : "vim -f",
+    "alias.co" : "checkout",
+    "core.bigfilethreshold" : "512k",
+  }
+  for key, value := range(expected) {
+    if v, ok := file.Get(key); !ok || v != value {
+      t.Errorf("Expecting %q for %s, got %q", value, key, v)
+    }
+  }
+  if _, ok := file.Get("core.bare"); ok {
+    t.Error("core.bare should have been removed")
+  }
+  // A missing file is empty, but a file which can't be read is an error.
+  if file, err := LoadConfigFile(filepath.Join(dir, "missing")); err != nil || file == nil {
+    t.Error("Expecting an empty config for a missing file")
+  }
+  if _, err := LoadConfigFile(dir); err == nil {
+    t.Error("Expecting error for a config path which can't be read")
+  }
+}
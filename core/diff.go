@@ -0,0 +1,235 @@
+package core
+
+import (
+  "bytes"
+  "strings"
+)
+
+// The kind of a line in diff.
+type DiffOpKind int
+
+const (
+  DiffEqual DiffOpKind = iota
+  DiffInsert
+  DiffDelete
+)
+
+// A single line of diff. ALine and BLine are the 0-based indexes of the line in the old
+// and new text, ALine is -1 for inserted lines and BLine is -1 for deleted lines.
+type DiffOp struct {
+  Kind DiffOpKind
+  ALine int
+  BLine int
+  Text string
+}
+
+// A hunk of diff, i.e. a group of changed lines with lines of context around them.
+// AStart and BStart are 0-based.
+type Hunk struct {
+  AStart, ALen int
+  BStart, BLen int
+  Ops []DiffOp
+}
+
+// A change of a contiguous range of lines, lines [AStart, AEnd) of the old text are
+// replaced by Lines.
+type LineChange struct {
+  AStart, AEnd int
+  Lines []string
+}
+
+// Splits the data to lines, each line keeps its trailing "\n" so joining the lines gives
+// the original data. The last line doesn't have "\n" if the data doesn't end with it.
+func SplitLines(data []byte) []string {
+  lines := make([]string, 0, bytes.Count(data, []byte("\n")) + 1)
+  for len(data) > 0 {
+    idx := bytes.IndexByte(data, '\n')
+    if idx == -1 {
+      lines = append(lines, string(data))
+      break
+    }
+    lines = append(lines, string(data[:idx + 1]))
+    data = data[idx + 1:]
+  }
+  return lines
+}
+
+// Joins the lines split by SplitLines.
+func JoinLines(lines []string) []byte {
+  return []byte(strings.Join(lines, ""))
+}
+
+// Checks whether the data looks like binary, i.e. it contains NUL in the first 8000 bytes.
+func IsBinary(data []byte) bool {
+  if len(data) > 8000 {
+    data = data[:8000]
+  }
+  return bytes.IndexByte(data, 0) != -1
+}
+
+// Computes the shortest edit script from a to b with Myers' algorithm. The ops cover
+// every line of a and b in order.
+func DiffLines(a, b []string) []DiffOp {
+  // Maps lines to integers so comparisons are cheap.
+  ids := make(map[string]int)
+  toIds := func(lines []string) []int {
+    ret := make([]int, len(lines))
+    for i, line := range(lines) {
+      id, ok := ids[line]
+      if !ok {
+        id = len(ids)
+        ids[line] = id
+      }
+      ret[i] = id
+    }
+    return ret
+  }
+  x, y := toIds(a), toIds(b)
+  n, m := len(x), len(y)
+  max := n + m
+  offset := max + 1
+  v := make([]int, 2 * max + 3)
+  // trace[d] keeps v[-d..d] before the dth step, which is needed for backtracking.
+  trace := make([][]int, 0)
+  found := false
+  for d := 0; d <= max && !found; d++ {
+    trace = append(trace, append([]int(nil), v[offset - d:offset + d + 1]...))
+    for k := -d; k <= d; k += 2 {
+      var i int
+      if k == -d || (k != d && v[offset + k - 1] < v[offset + k + 1]) {
+        i = v[offset + k + 1]
+      } else {
+        i = v[offset + k - 1] + 1
+      }
+      j := i - k
+      for i < n && j < m && x[i] == y[j] {
+        i++
+        j++
+      }
+      v[offset + k] = i
+      if i >= n && j >= m {
+        found = true
+        break
+      }
+    }
+  }
+
+  // Backtracks from (n, m) to (0, 0), the ops are collected in reverse order.
+  ops := make([]DiffOp, 0, n + m)
+  i, j := n, m
+  for d := len(trace) - 1; d >= 0; d-- {
+    vd := trace[d]
+    get := func(k int) int {
+      return vd[k + d]
+    }
+    prevI, prevJ := 0, 0
+    if d > 0 {
+      k := i - j
+      prevK := k - 1
+      if k == -d || (k != d && get(k - 1) < get(k + 1)) {
+        prevK = k + 1
+      }
+      prevI = get(prevK)
+      prevJ = prevI - prevK
+    }
+    for i > prevI && j > prevJ {
+      i--
+      j--
+      ops = append(ops, DiffOp{DiffEqual, i, j, a[i]})
+    }
+    if d > 0 {
+      if i == prevI {
+        ops = append(ops, DiffOp{DiffInsert, -1, prevJ, b[prevJ]})
+      } else {
+        ops = append(ops, DiffOp{DiffDelete, prevI, -1, a[prevI]})
+      }
+    }
+    i, j = prevI, prevJ
+  }
+  for l, r := 0, len(ops) - 1; l < r; l, r = l + 1, r - 1 {
+    ops[l], ops[r] = ops[r], ops[l]
+  }
+  return ops
+}
+
+// Gets the changes from a to b, each change is a maximal run of non-equal lines.
+func GetLineChanges(a, b []string) []LineChange {
+  changes := make([]LineChange, 0)
+  ops := DiffLines(a, b)
+  aLine := 0
+  for idx := 0; idx < len(ops); {
+    if ops[idx].Kind == DiffEqual {
+      aLine++
+      idx++
+      continue
+    }
+    change := LineChange{AStart : aLine, AEnd : aLine, Lines : make([]string, 0)}
+    for ; idx < len(ops) && ops[idx].Kind != DiffEqual; idx++ {
+      if ops[idx].Kind == DiffDelete {
+        change.AEnd++
+        aLine++
+      } else {
+        change.Lines = append(change.Lines, ops[idx].Text)
+      }
+    }
+    changes = append(changes, change)
+  }
+  return changes
+}
+
+// Groups the ops to hunks with the given number of context lines around changes.
+func GetHunks(ops []DiffOp, context int) []Hunk {
+  hunks := make([]Hunk, 0)
+  // Finds the ranges of ops to include in each hunk.
+  start, end := -1, -1
+  flush := func() {
+    if start == -1 {
+      return
+    }
+    hunk := Hunk{Ops : ops[start:end]}
+    aLine, bLine := 0, 0
+    for idx := 0; idx < start; idx++ {
+      if ops[idx].Kind != DiffInsert {
+        aLine++
+      }
+      if ops[idx].Kind != DiffDelete {
+        bLine++
+      }
+    }
+    hunk.AStart, hunk.BStart = aLine, bLine
+    for _, op := range(hunk.Ops) {
+      if op.Kind != DiffInsert {
+        hunk.ALen++
+      }
+      if op.Kind != DiffDelete {
+        hunk.BLen++
+      }
+    }
+    hunks = append(hunks, hunk)
+    start, end = -1, -1
+  }
+  for idx, op := range(ops) {
+    if op.Kind == DiffEqual {
+      continue
+    }
+    from := idx - context
+    if from < 0 {
+      from = 0
+    }
+    to := idx + context + 1
+    if to > len(ops) {
+      to = len(ops)
+    }
+    if start != -1 && from > end {
+      flush()
+    }
+    if start == -1 {
+      start = from
+    }
+    if to > end {
+      end = to
+    }
+  }
+  flush()
+  return hunks
+}
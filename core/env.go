@@ -25,6 +25,7 @@ var (
   pathPrefix = ""
   headFilePath = ""
   branchHeadDir = ""
+  tagDir = ""
 )
 
 func initPaths(wd string) {
@@ -39,8 +40,11 @@ func initPaths(wd string) {
   pathPrefix = "/" + pathPrefix
   headFilePath = filepath.Join(fleaDirectory, "HEAD")
   branchHeadDir = filepath.Join(fleaDirectory, filepath.Join("refs", "heads"))
+  tagDir = filepath.Join(fleaDirectory, filepath.Join("refs", "tags"))
   // log.Println(repoDirectory, fleaDirectory, storeDirectory, pathPrefix)
   initialized = true
+  // The merged config needs to be reloaded to include the config of the repository.
+  config = nil
 }
 
 // Creating a new Flea repository in current working directory.
@@ -58,9 +62,10 @@ func InitNew() error {
   os.Mkdir(filepath.Join(fd, "objects"), os.ModeDir | 0777)
   os.Mkdir(filepath.Join(fd, "refs"), os.ModeDir | 0777)
   os.Mkdir(filepath.Join(fd, filepath.Join("refs", "heads")), os.ModeDir | 0777)
-  os.Mkdir(filepath.Join(fd, "infos"), os.ModeDir | 0777)
+  os.Mkdir(filepath.Join(fd, filepath.Join("refs", "tags")), os.ModeDir | 0777)
+  os.Mkdir(filepath.Join(fd, "info"), os.ModeDir | 0777)
   initPaths(cwd)
-  return nil
+  return GetConfig().Set(ConfigLocal, "core.repositoryformatversion", "1")
 }
 
 // Initializing Flea from an existing Flea repository.
@@ -115,6 +120,12 @@ func GetBranchHeadDir() string {
   return branchHeadDir
 }
 
+// Get the full path of tag dir. /refs/tags/
+func GetTagDir() string {
+  assertInit()
+  return tagDir
+}
+
 // Gets current branch. The return values can be 1 of 3:
 // 1) branch name and nil.
 // 2) empty branch and ErrNoHeadFile.
@@ -140,6 +151,29 @@ func GetCurrentBranch() (branch string, err error) {
 // 1) A valid CommitTree object and nil.
 // 2) nil and ErrNoHeadFile.
 func GetCurrentCommit() (*Commit, error) {
+  commitHash, err := GetHeadHash()
+  if err != nil {
+    return nil, err
+  }
+  fType, data, err := GetCAStore().Get(commitHash)
+  if err != nil {
+    log.Fatalf("Failed to get %x from CAStore", commitHash)
+  }
+  if fType != CommitType {
+    log.Fatalf("The hash %x doesn't point to a commit object.", commitHash)
+  }
+  commit, err := fromBytesToCommitObject(data)
+  if err != nil {
+    log.Fatalf("Failed to convert file in %x to commit object.", commitHash)
+  }
+  return commit, nil
+}
+
+// Gets the hash of the commit HEAD points to, either through a branch or directly. The
+// return values can be:
+// 1) The hash and nil.
+// 2) nil and ErrNoHeadFile.
+func GetHeadHash() ([]byte, error) {
   branch, err := GetCurrentBranch()
   var commitHash []byte
   if err == nil {
@@ -161,18 +195,7 @@ func GetCurrentCommit() (*Commit, error) {
   if commitHash, err = hex.DecodeString(string(commitHash)); err != nil {
     log.Fatal("Not a valid hash string.")
   }
-  fType, data, err := GetCAStore().Get(commitHash)
-  if err != nil {
-    log.Fatal("Failed to get %x from CAStore", commitHash)
-  }
-  if fType != CommitType {
-    log.Fatal("The hash %x doesn't point to a commit object.", commitHash)
-  }
-  commit, err := fromBytesToCommitObject(data)
-  if err != nil {
-    log.Fatal("Failed to convert file in %x to commit object.", commitHash)
-  }
-  return commit, nil
+  return commitHash, nil
 }
 
 // Gets the hash of the HEAD of a branch.
@@ -191,18 +214,49 @@ func GetBranchHead(branch string) []byte {
   return hash
 }
 
-// Updates the head commit of a the branch.
-func UpdateBranchHead(branch string, commitHash []byte) {
+// Updates the head commit of a the branch. The update is recorded in the reflog of the
+// branch with the reason, and also in the reflog of HEAD if it's current branch.
+func UpdateBranchHead(branch string, commitHash []byte, reason string) {
   if !GetCAStore().Exists(commitHash) {
     panic("Not a valid commit hash.")
   }
+  branchPath := filepath.Join(GetBranchHeadDir(), branch)
+  var oldHash []byte
+  if data, err := read(branchPath); err == nil {
+    oldHash, _ = hex.DecodeString(string(data))
+  }
   hashString := hex.EncodeToString(commitHash)
-  write(filepath.Join(GetBranchHeadDir(), branch), []byte(hashString))
+  write(branchPath, []byte(hashString))
+  AppendReflog("refs/heads/" + branch, oldHash, commitHash, reason)
+  if current, err := GetCurrentBranch(); err == nil && current == branch {
+    AppendReflog("HEAD", oldHash, commitHash, reason)
+  }
 }
 
-// Updates the HEAD file.
-func WriteHeadFile(data []byte) {
+// Updates the HEAD file. The change of the commit HEAD points to is recorded in the
+// reflog of HEAD with the reason.
+func WriteHeadFile(data []byte, reason string) {
+  oldHash := peekHeadHash()
   write(getHeadFilePath(), data)
+  if newHash := peekHeadHash(); newHash != nil {
+    AppendReflog("HEAD", oldHash, newHash, reason)
+  }
+}
+
+// Updates the commit HEAD points to, either the head of current branch or HEAD itself if
+// it's detached.
+func UpdateHead(commitHash []byte, reason string) {
+  if branch, err := GetCurrentBranch(); err == nil {
+    UpdateBranchHead(branch, commitHash, reason)
+  } else {
+    WriteHeadFile([]byte(hex.EncodeToString(commitHash)), reason)
+  }
+}
+
+// Gets the name of the branch created by the first commit, it's configured by
+// init.defaultBranch.
+func GetDefaultBranch() string {
+  return GetConfig().GetString("init.defaultbranch", "master")
 }
 
 // Checks whether a branch is valid or not.
@@ -217,6 +271,19 @@ func IsValidBranch(branch string) bool {
   return false
 }
 
+// Same as GetHeadHash, but returns nil instead of failing if HEAD doesn't point to a
+// commit yet.
+func peekHeadHash() []byte {
+  if branch, err := GetCurrentBranch(); err == nil {
+    hash, _ := readRef("refs/heads/" + branch)
+    return hash
+  } else if err == ErrNotBranch {
+    hash, _ := readRef("HEAD")
+    return hash
+  }
+  return nil
+}
+
 func getHeadFilePath() string {
   assertInit()
   return headFilePath
@@ -2,6 +2,7 @@ package core
 
 import (
   "os"
+  "path"
   "path/filepath"
 )
 
@@ -12,22 +13,60 @@ var fsTree *FsTree
 type FsTree struct {
   baseFsPath string
   cache map[string]*FsTreeNode
+  // The matcher of ignored paths, nil if no path is ignored.
+  ignore *IgnoreMatcher
 }
 
-// Gets the singleton FsTree.
+// Gets the singleton FsTree. Paths which are ignored by .fleaignore files and not in the
+// index are left out of it.
 func GetFsTree() *FsTree {
   if fsTree == nil {
     fsTree = newFsTree(GetRepoDirectory())
+    excludeFile := filepath.Join(GetFleaDirectory(), "info", "exclude")
+    fsTree.ignore = NewIgnoreMatcher(GetRepoDirectory(), excludeFile)
   }
   return fsTree
 }
 
+// Gets a FsTree of the same directory which includes the ignored paths.
+func (ft *FsTree) IncludeIgnored() *FsTree {
+  return newFsTree(ft.baseFsPath)
+}
+
+// Checks whether the path is ignored by .fleaignore files, it doesn't matter whether
+// the path is in the index.
+func (ft *FsTree) IsIgnored(treePath string) bool {
+  if ft.ignore == nil {
+    return false
+  }
+  fi, err := os.Lstat(filepath.Join(ft.baseFsPath, filepath.FromSlash(treePath)))
+  return ft.ignore.IsIgnored(treePath, err == nil && fi.IsDir())
+}
+
+// Checks whether the path is left out of the tree, i.e. it's ignored and not tracked.
+func (ft *FsTree) isHidden(treePath string, isDir bool) bool {
+  if ft.ignore == nil || !ft.ignore.IsIgnored(treePath, isDir) {
+    return false
+  }
+  _, err := GetIndexTree().Get(path.Join("/", treePath))
+  return err != nil
+}
+
 // Constructs a FsTree with the given path directory.
 func newFsTree(fsPath string) *FsTree {
   tree := &FsTree{baseFsPath :fsPath, cache : make(map[string]*FsTreeNode)}
   return tree
 }
 
+// Drops the cached nodes, it must be called when the working directory has been changed
+// since the nodes were read.
+func (ft *FsTree) ClearCache() {
+  ft.cache = make(map[string]*FsTreeNode)
+  if ft.ignore != nil {
+    ft.ignore.ClearCache()
+  }
+}
+
 // See Tree interface.
 func (ft *FsTree) Get(treePath string) (Node, error) {
   if node, ok := ft.cache[treePath]; ok {
@@ -81,7 +120,7 @@ func (n *FsTreeNode) GetHashValue() []byte {
     n.hash = hash[:]
   } else {
     // If it's a file, the hash value is the hash value of the file.
-    data, err := read(n.fsPath)
+    data, err := n.GetData()
     if err != nil {
       panic("Error while reading file " + n.fsPath)
     }
@@ -92,12 +131,25 @@ func (n *FsTreeNode) GetHashValue() []byte {
 }
 
 func (n *FsTreeNode) IsDir() bool {
-  if fi, err := os.Stat(n.fsPath); err == nil {
-    return fi.IsDir()
+  return n.GetMode() == ModeDir
+}
+
+func (n *FsTreeNode) GetMode() FileMode {
+  if fi, err := n.lstat(); err == nil {
+    return fileModeOf(fi)
   }
   panic("File not exists")
 }
 
+// Gets the info of the file without following symlinks, so a symlink is a node itself
+// rather than its target. The root is followed in case the repository is under a link.
+func (n *FsTreeNode) lstat() (os.FileInfo, error) {
+  if n.fsPath == n.tree.baseFsPath {
+    return os.Stat(n.fsPath)
+  }
+  return os.Lstat(n.fsPath)
+}
+
 func (n *FsTreeNode) GetChildren() map[string]Node {
   if n.children != nil {
     return n.children
@@ -116,6 +168,12 @@ func (n *FsTreeNode) GetChildren() map[string]Node {
       return err
     }
     treePath := filepath.ToSlash(relPath)
+    if n.tree.isHidden(treePath, info.IsDir()) {
+      if info.IsDir() {
+        return filepath.SkipDir
+      }
+      return nil
+    }
     children[name], err = n.tree.Get(treePath)
     if err != nil {
       panic(err.Error() + fsPath)
@@ -131,16 +189,26 @@ func (n *FsTreeNode) GetChildren() map[string]Node {
   return children
 }
 
+// Gets the data of the file, it's the target path for symlinks.
 func (n *FsTreeNode) GetData() ([]byte, error) {
-  if n.IsDir() {
+  switch n.GetMode() {
+  case ModeDir:
     return nil, ErrNotFile
+  case ModeSymlink:
+    target, err := os.Readlink(n.fsPath)
+    if err != nil {
+      return nil, err
+    }
+    return []byte(filepath.ToSlash(target)), nil
   }
   data, err := read(n.fsPath)
   return data, err
 }
 
+// Checks whether the file exists, dangling symlinks exist too.
 func (n *FsTreeNode) IsExist() bool {
-  return exists(n.fsPath)
+  _, err := n.lstat()
+  return err == nil
 }
 
 func (n *FsTreeNode) String() string {
@@ -0,0 +1,70 @@
+package core
+
+import (
+  "bytes"
+  "regexp"
+)
+
+// A line matching the pattern, Line is 1-based and Text doesn't contain the newline.
+type GrepMatch struct {
+  Line int
+  Text string
+}
+
+// Compiles the pattern of grep. Unless extended is set the pattern is a basic regular
+// expression, where "+", "?", "|", "(", ")", "{" and "}" are literal and have their
+// special meaning when escaped by "\".
+func CompileGrepPattern(pattern string, extended, ignoreCase bool) (*regexp.Regexp, error) {
+  if !extended {
+    var buf bytes.Buffer
+    for i := 0; i < len(pattern); i++ {
+      c := pattern[i]
+      switch {
+      case c == '\\' && i + 1 < len(pattern) && isBasicRegexpMeta(pattern[i + 1]):
+        i++
+        buf.WriteByte(pattern[i])
+      case isBasicRegexpMeta(c):
+        buf.WriteByte('\\')
+        buf.WriteByte(c)
+      case c == '\\' && i + 1 < len(pattern):
+        i++
+        buf.WriteByte(c)
+        buf.WriteByte(pattern[i])
+      default:
+        buf.WriteByte(c)
+      }
+    }
+    pattern = buf.String()
+  }
+  if ignoreCase {
+    pattern = "(?i)" + pattern
+  }
+  return regexp.Compile(pattern)
+}
+
+func isBasicRegexpMeta(c byte) bool {
+  switch c {
+  case '+', '?', '|', '(', ')', '{', '}':
+    return true
+  }
+  return false
+}
+
+// Gets the lines of data matching the regular expression.
+func GrepLines(re *regexp.Regexp, data []byte) []GrepMatch {
+  matches := make([]GrepMatch, 0)
+  for i, line := range(SplitLines(data)) {
+    line = trimNewline(line)
+    if re.MatchString(line) {
+      matches = append(matches, GrepMatch{Line : i + 1, Text : line})
+    }
+  }
+  return matches
+}
+
+func trimNewline(line string) string {
+  if len(line) > 0 && line[len(line) - 1] == '\n' {
+    return line[:len(line) - 1]
+  }
+  return line
+}
@@ -0,0 +1,47 @@
+package core
+
+import (
+  "testing"
+)
+
+func TestCompileGrepPattern(t *testing.T) {
+  cases := []struct {
+    pattern string
+    extended bool
+    ignoreCase bool
+    text string
+    match bool
+  }{
+    {"a+", false, false, "a+", true},
+    {"a+", false, false, "aa", false},
+    {"a\\+", false, false, "aa", true},
+    {"f(x)", false, false, "f(x)", true},
+    {"a\\|b", false, false, "b", true},
+    {"a|b", true, false, "b", true},
+    {"^fo*$", false, false, "foo", true},
+    {"\\.go$", false, false, "main.go", true},
+    {"\\.go$", false, false, "main_go", false},
+    {"HELLO", false, true, "hello", true},
+  }
+  for _, c := range(cases) {
+    re, err := CompileGrepPattern(c.pattern, c.extended, c.ignoreCase)
+    if err != nil {
+      t.Fatal(err)
+    }
+    if re.MatchString(c.text) != c.match {
+      t.Errorf("Expecting %q matching %q to be %v", c.pattern, c.text, c.match)
+    }
+  }
+  if _, err := CompileGrepPattern("a(", true, false); err == nil {
+    t.Error("Expecting error for invalid pattern")
+  }
+}
+
+func TestGrepLines(t *testing.T) {
+  re, _ := CompileGrepPattern("o", false, false)
+  matches := GrepLines(re, []byte("one\ntwo\nthree\nfour"))
+  if len(matches) != 3 || matches[0] != (GrepMatch{1, "one"}) ||
+     matches[2] != (GrepMatch{4, "four"}) {
+    t.Error("Unexpected matches", matches)
+  }
+}
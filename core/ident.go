@@ -0,0 +1,175 @@
+package core
+
+import (
+  "errors"
+  "fmt"
+  "os"
+  "os/user"
+  "strconv"
+  "strings"
+  "time"
+)
+
+var (
+  ErrInvalidIdent = errors.New("core: invalid identity, expecting 'Name <email>'")
+  ErrInvalidDate = errors.New("core: invalid date format")
+)
+
+// The layouts accepted by ParseDate, besides the "<unix-seconds> <zone>" form.
+var dateLayouts = []string {
+  time.RFC3339,
+  "2006-01-02 15:04:05 -0700",
+  "2006-01-02 15:04:05",
+  "2006-01-02T15:04:05",
+  "Mon Jan 2 15:04:05 2006 -0700",
+  "2006-01-02",
+}
+
+// Signature identifies who did something and when. It's used for the author and
+// committer of a commit.
+type Signature struct {
+  Name  string
+  Email string
+  When  time.Time
+}
+
+// Converts the signature to "Name <email>".
+func (s Signature) String() string {
+  return fmt.Sprintf("%s <%s>", s.Name, s.Email)
+}
+
+// Gets the identity of the author. The name and email come from author.name/email or
+// user.name/email in config, they and the date can be overridden by FLEA_AUTHOR_NAME,
+// FLEA_AUTHOR_EMAIL and FLEA_AUTHOR_DATE environment variables.
+func GetAuthorIdent() (Signature, error) {
+  return getIdent("FLEA_AUTHOR", "author")
+}
+
+// Gets the identity of the committer. The name and email come from committer.name/email
+// or user.name/email in config, they and the date can be overridden by
+// FLEA_COMMITTER_NAME, FLEA_COMMITTER_EMAIL and FLEA_COMMITTER_DATE environment variables.
+func GetCommitterIdent() (Signature, error) {
+  return getIdent("FLEA_COMMITTER", "committer")
+}
+
+// Parses "Name <email>" to a Signature, the time of the returned signature is not set.
+func ParseIdent(ident string) (Signature, error) {
+  lt := strings.Index(ident, "<")
+  gt := strings.LastIndex(ident, ">")
+  if lt == -1 || gt < lt {
+    return Signature{}, ErrInvalidIdent
+  }
+  name := strings.TrimSpace(ident[:lt])
+  email := strings.TrimSpace(ident[lt + 1:gt])
+  if name == "" {
+    return Signature{}, ErrInvalidIdent
+  }
+  return Signature{Name : name, Email : email}, nil
+}
+
+// The units of relative dates, months and years are approximate.
+var dateUnits = map[string]time.Duration {
+  "second" : time.Second,
+  "minute" : time.Minute,
+  "hour" : time.Hour,
+  "day" : 24 * time.Hour,
+  "week" : 7 * 24 * time.Hour,
+  "month" : 30 * 24 * time.Hour,
+  "year" : 365 * 24 * time.Hour,
+}
+
+// Parses the date string. Besides the layouts in dateLayouts it also accepts the
+// "<unix-seconds> <zone>" form, e.g. "1700000000 +0100", and relative dates like "now",
+// "yesterday" and "2 weeks ago".
+func ParseDate(date string) (time.Time, error) {
+  date = strings.TrimSpace(date)
+  if t, ok := parseRelativeDate(date); ok {
+    return t, nil
+  }
+  if fields := strings.Fields(date); len(fields) == 2 {
+    if secs, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+      if zone, err := time.Parse("-0700", fields[1]); err == nil {
+        return time.Unix(secs, 0).In(zone.Location()), nil
+      }
+    }
+  }
+  if secs, err := strconv.ParseInt(date, 10, 64); err == nil {
+    return time.Unix(secs, 0), nil
+  }
+  for _, layout := range(dateLayouts) {
+    if t, err := time.ParseInLocation(layout, date, time.Local); err == nil {
+      return t, nil
+    }
+  }
+  return time.Time{}, ErrInvalidDate
+}
+
+// Parses the relative date in the form of "<n> <unit>[s] ago", "now" or "yesterday".
+func parseRelativeDate(date string) (time.Time, bool) {
+  now := time.Now()
+  switch date {
+  case "now":
+    return now, true
+  case "yesterday":
+    return now.Add(-dateUnits["day"]), true
+  }
+  fields := strings.Fields(date)
+  if len(fields) != 3 || fields[2] != "ago" {
+    return time.Time{}, false
+  }
+  n, err := strconv.Atoi(fields[0])
+  unit, ok := dateUnits[strings.TrimSuffix(fields[1], "s")]
+  if err != nil || !ok {
+    return time.Time{}, false
+  }
+  return now.Add(-time.Duration(n) * unit), true
+}
+
+// Formats the time the way it's stored in objects.
+func FormatDate(t time.Time) string {
+  return t.Format(time.RFC3339)
+}
+
+func getIdent(envPrefix, section string) (Signature, error) {
+  cfg := GetConfig()
+  sig := Signature{When : time.Now()}
+  sig.Name = cfg.GetString(section + ".name", cfg.GetString("user.name", defaultName()))
+  sig.Email = cfg.GetString(section + ".email", cfg.GetString("user.email", defaultEmail()))
+  if name := os.Getenv(envPrefix + "_NAME"); name != "" {
+    sig.Name = name
+  }
+  if email := os.Getenv(envPrefix + "_EMAIL"); email != "" {
+    sig.Email = email
+  }
+  if date := os.Getenv(envPrefix + "_DATE"); date != "" {
+    when, err := ParseDate(date)
+    if err != nil {
+      return sig, err
+    }
+    sig.When = when
+  }
+  return sig, nil
+}
+
+func defaultName() string {
+  if u, err := user.Current(); err == nil {
+    // The full name may carry other GECOS fields separated by commas.
+    if name := strings.Split(u.Name, ",")[0]; name != "" {
+      return name
+    }
+    return u.Username
+  }
+  return "unknown"
+}
+
+func defaultEmail() string {
+  username := "unknown"
+  if u, err := user.Current(); err == nil {
+    username = u.Username
+  }
+  hostname, err := os.Hostname()
+  if err != nil || hostname == "" {
+    hostname = "localhost"
+  }
+  return username + "@" + hostname
+}
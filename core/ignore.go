@@ -0,0 +1,199 @@
+package core
+
+import (
+  "os"
+  "path"
+  "path/filepath"
+  "strings"
+)
+
+// The name of the files which list the patterns of paths to ignore.
+const IgnoreFileName = ".fleaignore"
+
+// A pattern of paths to ignore, in the syntax of gitignore.
+type ignoreRule struct {
+  // The pattern without the leading "!", the leading "/" and the trailing "/".
+  pattern string
+  // The pattern starts with "!", paths matching it are not ignored.
+  negate bool
+  // The pattern ends with "/", it only matches directories.
+  dirOnly bool
+  // The pattern contains "/" other than the trailing one, it's matched against the path
+  // relative to base, otherwise it's matched against the name.
+  anchored bool
+  // The tree path of the directory the pattern is defined in.
+  base string
+}
+
+// IgnoreMatcher checks whether paths are ignored by the patterns in .flea/info/exclude
+// and the .fleaignore files in the working directory. The patterns of a .fleaignore file
+// apply to the directory it's in, patterns of deeper files and later lines take
+// precedence. The patterns are read lazily and cached.
+type IgnoreMatcher struct {
+  repoDir string
+  excludeFile string
+  rules map[string][]ignoreRule
+}
+
+// Constructs an IgnoreMatcher of the working directory, the patterns of excludeFile apply
+// to the whole directory.
+func NewIgnoreMatcher(repoDir, excludeFile string) *IgnoreMatcher {
+  return &IgnoreMatcher{repoDir, excludeFile, make(map[string][]ignoreRule)}
+}
+
+// Checks whether the path is ignored. A path is ignored if any of its parent directories
+// is ignored, in which case it can't be re-included by negated patterns.
+func (m *IgnoreMatcher) IsIgnored(treePath string, isDir bool) bool {
+  treePath = path.Join("/", treePath)
+  if treePath == "/" {
+    return false
+  }
+  dirs := strings.Split(treePath[1:], "/")
+  for i := 1; i < len(dirs); i++ {
+    if m.matches("/" + strings.Join(dirs[:i], "/"), true) {
+      return true
+    }
+  }
+  return m.matches(treePath, isDir)
+}
+
+// Drops the cached patterns, they are read again when needed.
+func (m *IgnoreMatcher) ClearCache() {
+  m.rules = make(map[string][]ignoreRule)
+}
+
+// Checks the path against the patterns which apply to it, ignoring its parents.
+func (m *IgnoreMatcher) matches(treePath string, isDir bool) bool {
+  ignored := false
+  check := func(rules []ignoreRule) {
+    for _, rule := range(rules) {
+      if rule.match(treePath, isDir) {
+        ignored = !rule.negate
+      }
+    }
+  }
+  // The exclude file comes first, then the .fleaignore files from the root down to the
+  // directory of the path.
+  dirs := make([]string, 0)
+  for dir := path.Dir(treePath); ; dir = path.Dir(dir) {
+    dirs = append(dirs, dir)
+    if dir == "/" {
+      break
+    }
+  }
+  check(m.getRules(""))
+  for i := len(dirs) - 1; i >= 0; i-- {
+    check(m.getRules(dirs[i]))
+  }
+  return ignored
+}
+
+// Gets the patterns of the .fleaignore file in the directory, or the exclude file if dir
+// is empty.
+func (m *IgnoreMatcher) getRules(dir string) []ignoreRule {
+  if rules, ok := m.rules[dir]; ok {
+    return rules
+  }
+  fsPath, base := m.excludeFile, "/"
+  if dir != "" {
+    fsPath = filepath.Join(m.repoDir, filepath.FromSlash(dir), IgnoreFileName)
+    base = dir
+  }
+  var rules []ignoreRule
+  if fi, err := os.Stat(fsPath); err == nil && fi.Mode().IsRegular() {
+    if data, err := read(fsPath); err == nil {
+      rules = parseIgnoreRules(string(data), base)
+    }
+  }
+  m.rules[dir] = rules
+  return rules
+}
+
+// Parses the patterns, one per line. Empty lines and lines starting with "#" are skipped,
+// "\#" and "\!" escape the leading characters.
+func parseIgnoreRules(data, base string) []ignoreRule {
+  rules := make([]ignoreRule, 0)
+  for _, line := range(strings.Split(data, "\n")) {
+    line = strings.TrimRight(line, "\r")
+    // Trailing spaces are ignored unless they are escaped.
+    for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+      line = line[:len(line) - 1]
+    }
+    if line == "" || strings.HasPrefix(line, "#") {
+      continue
+    }
+    rule := ignoreRule{base : base}
+    if strings.HasPrefix(line, "!") {
+      rule.negate = true
+      line = line[1:]
+    } else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+      line = line[1:]
+    }
+    if strings.HasSuffix(line, "/") {
+      rule.dirOnly = true
+      line = strings.TrimRight(line, "/")
+    }
+    if strings.Contains(line, "/") {
+      rule.anchored = true
+      line = strings.TrimLeft(line, "/")
+    }
+    if line == "" {
+      continue
+    }
+    rule.pattern = line
+    rules = append(rules, rule)
+  }
+  return rules
+}
+
+// Checks whether the path matches the rule.
+func (rule ignoreRule) match(treePath string, isDir bool) bool {
+  if rule.dirOnly && !isDir {
+    return false
+  }
+  rel := treePath
+  if rule.base != "/" {
+    if !strings.HasPrefix(treePath, rule.base + "/") {
+      return false
+    }
+    rel = treePath[len(rule.base):]
+  }
+  rel = rel[1:]
+  if !rule.anchored {
+    return MatchGlob(rule.pattern, path.Base(rel))
+  }
+  return MatchGlob(rule.pattern, rel)
+}
+
+// Matches the slash-separated path against the pattern. "*", "?" and character classes
+// don't match "/", "**" as a whole component matches zero or more components, except a
+// trailing "**" matches one or more.
+func MatchGlob(pattern, name string) bool {
+  return matchGlobParts(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobParts(patterns, names []string) bool {
+  for len(patterns) > 0 {
+    if patterns[0] == "**" {
+      if len(patterns) == 1 {
+        // A trailing "**" matches everything inside, but not the directory itself.
+        return len(names) > 0
+      }
+      // Tries to match the rest of the pattern at every position.
+      for i := 0; i <= len(names); i++ {
+        if matchGlobParts(patterns[1:], names[i:]) {
+          return true
+        }
+      }
+      return false
+    }
+    if len(names) == 0 {
+      return false
+    }
+    if matched, err := path.Match(patterns[0], names[0]); err != nil || !matched {
+      return false
+    }
+    patterns, names = patterns[1:], names[1:]
+  }
+  return len(names) == 0
+}
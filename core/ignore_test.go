@@ -0,0 +1,124 @@
+package core
+
+import (
+  "path/filepath"
+  "testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+  expected := map[[2]string]bool {
+    {"*.o", "a.o"} : true,
+    {"*.o", "dir/a.o"} : false,
+    {"dir/*.o", "dir/a.o"} : true,
+    {"**/a.o", "a.o"} : true,
+    {"**/a.o", "x/y/a.o"} : true,
+    {"a/**/b", "a/b"} : true,
+    {"a/**/b", "a/x/y/b"} : true,
+    {"a/**/b", "a/x/y/c"} : false,
+    {"a/**", "a/x/y"} : true,
+    {"a/**", "a"} : false,
+    {"?.[ch]", "x.c"} : true,
+    {"?.[ch]", "xy.c"} : false,
+  }
+  for args, result := range(expected) {
+    if MatchGlob(args[0], args[1]) != result {
+      t.Errorf("Expecting %v for MatchGlob(%q, %q)", result, args[0], args[1])
+    }
+  }
+}
+
+func TestIgnoreMatcher(t *testing.T) {
+  dir, err := mkDir("test_ignore_matcher")
+  if err != nil {
+    t.Fatal(err)
+  }
+  files := map[string][]byte {
+    "exclude" : []byte("*.swp\n"),
+    IgnoreFileName : []byte("# comment\n*.o\n!keep.o\nbuild/\n/root.txt\ndoc/*.html\n" +
+                            "gen/**\n!gen/keep\n"),
+    "src/" + IgnoreFileName : []byte("*.gen\n!*.o\n"),
+  }
+  if err = createTempFiles(dir, files); err != nil {
+    t.Fatal(err)
+  }
+  m := NewIgnoreMatcher(dir, filepath.Join(dir, "exclude"))
+  expected := map[string]bool {
+    "/a.o" : true,
+    "/x/y/a.o" : true,
+    "/keep.o" : false,
+    "/build" : true,
+    "/build/file" : true,
+    "/x/build" : true,
+    "/root.txt" : true,
+    "/x/root.txt" : false,
+    "/doc/a.html" : true,
+    "/doc/x/a.html" : false,
+    "/src/a.gen" : true,
+    "/a.gen" : false,
+    "/src/a.o" : false,
+    "/a.swp" : true,
+    "/.editorconfig" : false,
+    // "gen/**" matches what's inside gen, so gen/keep can be re-included.
+    "/gen" : false,
+    "/gen/x" : true,
+    "/gen/keep" : false,
+  }
+  for treePath, result := range(expected) {
+    isDir := treePath == "/build" || treePath == "/x/build" || treePath == "/gen"
+    if m.IsIgnored(treePath, isDir) != result {
+      t.Errorf("Expecting IsIgnored(%s) to be %v", treePath, result)
+    }
+  }
+  // A file named build is not matched by "build/".
+  if m.IsIgnored("/build", false) {
+    t.Error("Expecting file /build not to be ignored")
+  }
+}
+
+func TestFsTreeIgnore(t *testing.T) {
+  dir, err := initTestRepo("test_fs_tree_ignore")
+  if err != nil {
+    t.Fatal(err)
+  }
+  files := map[string][]byte {
+    IgnoreFileName : []byte("*.o\nbuild/\n"),
+    "a.o" : []byte("a"),
+    "tracked.o" : []byte("t"),
+    "build/out" : []byte("out"),
+    "src/main.c" : []byte("main"),
+    ".editorconfig" : []byte("root = true"),
+  }
+  if err = createTempFiles(dir, files); err != nil {
+    t.Fatal(err)
+  }
+  hash, _ := GetCAStore().StoreBlob([]byte("t"))
+  GetIndexTree().MkFile("/tracked.o", hash)
+
+  tree := GetFsTree()
+  paths := make(map[string]bool)
+  tree.Traverse(func(treePath string, node Node) error {
+    paths[treePath] = true
+    return nil
+  }, "/")
+  for _, p := range([]string{"/.fleaignore", "/tracked.o", "/src/main.c", "/.editorconfig"}) {
+    if !paths[p] {
+      t.Errorf("Expecting %s in FsTree", p)
+    }
+  }
+  for _, p := range([]string{"/a.o", "/build", "/build/out", "/.flea"}) {
+    if paths[p] {
+      t.Errorf("Expecting %s to be ignored", p)
+    }
+  }
+  if !tree.IsIgnored("/a.o") || !tree.IsIgnored("/tracked.o") || tree.IsIgnored("/src") {
+    t.Error("Unexpected result of IsIgnored")
+  }
+  all := make(map[string]bool)
+  tree.IncludeIgnored().Traverse(func(treePath string, node Node) error {
+    all[treePath] = true
+    return nil
+  }, "/")
+  if !all["/a.o"] || !all["/build/out"] {
+    t.Error("Expecting ignored paths in the tree including them")
+  }
+}
@@ -96,6 +96,15 @@ func (tree *IndexTree) MkFileAll(treePath string, hash []byte) (err error) {
   return
 }
 
+// Creates a file with given hash value and mode, along with any necessary parents.
+func (tree *IndexTree) MkFileAllMode(treePath string, hash []byte, mode FileMode) (err error) {
+  err = tree.memTree.MkFileAllMode(treePath, hash, mode)
+  if err == nil {
+    err = tree.flush()
+  }
+  return
+}
+
 // Deletes a node from the tree. If the node is a directory the whole directory will be
 // deleted.
 func (tree *IndexTree) Delete(treePath string) (err error) {
@@ -106,6 +115,25 @@ func (tree *IndexTree) Delete(treePath string) (err error) {
   return
 }
 
+// Moves the node of src to dst along with its subtree. See MemTree.
+func (tree *IndexTree) Move(src, dst string) (err error) {
+  err = tree.memTree.Move(src, dst)
+  if err == nil {
+    err = tree.flush()
+  }
+  return
+}
+
+// Replaces the node of the given path with the node of the same path in src tree, the
+// whole index is rebuilt from src if the path is root. See MemTree.
+func (tree *IndexTree) CopyFrom(src Tree, treePath string) (err error) {
+  err = tree.memTree.CopyFrom(src, treePath)
+  if err == nil {
+    err = tree.flush()
+  }
+  return
+}
+
 // See MemTree.
 func (tree *IndexTree) Clear() {
   tree.memTree.Clear()
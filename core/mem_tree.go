@@ -105,6 +105,15 @@ func (mt *MemTree) MkDirAll(treePath string) (err error) {
 
 // Creates a file with given hash value in tree. If the file exists then update the file.
 func (mt *MemTree) MkFile(treePath string, hash []byte) (err error) {
+  return mt.MkFileMode(treePath, hash, ModeRegular)
+}
+
+// Creates a file with given hash value and mode in tree. If the file exists then update
+// the file.
+func (mt *MemTree) MkFileMode(treePath string, hash []byte, mode FileMode) (err error) {
+  if mode == ModeDir {
+    return ErrInvalidMode
+  }
   if treePath == "/" {
     err = ErrReadOnlyRoot
     return
@@ -117,6 +126,7 @@ func (mt *MemTree) MkFile(treePath string, hash []byte) (err error) {
       return
     }
     node.Children[fileName] = newFileMemTreeNode(hash)
+    node.Children[fileName].Mode = mode
     changed = true
     return
   }
@@ -133,6 +143,16 @@ func (mt *MemTree) MkFileAll(treePath string, hash []byte) (err error) {
   return mt.MkFile(treePath, hash)
 }
 
+// MkFileAllMode creates a file with given path, hash value and mode, along with any
+// necessary parents.
+func (mt *MemTree) MkFileAllMode(treePath string, hash []byte, mode FileMode) (err error) {
+  dir := path.Dir(treePath)
+  if err := mt.mkdirAll(dir); err != nil {
+    return err
+  }
+  return mt.MkFileMode(treePath, hash, mode)
+}
+
 // Deletes a node from the tree. If the node is a directory the whole directory will be
 // deleted.
 func (mt *MemTree) Delete(treePath string) (err error) {
@@ -160,6 +180,63 @@ func (mt *MemTree) Delete(treePath string) (err error) {
   return
 }
 
+// Moves the node of src to dst, along with the whole subtree if it's a directory. dst
+// must not exist, its parent directories are created if necessary.
+func (mt *MemTree) Move(src, dst string) error {
+  if src == "/" || dst == "/" {
+    return ErrReadOnlyRoot
+  }
+  if dst == src || strings.HasPrefix(dst, src + "/") {
+    // A directory can't be moved into itself.
+    return ErrInvalidPath
+  }
+  node, err := mt.Get(src)
+  if err != nil {
+    return err
+  }
+  if _, err := mt.Get(dst); err == nil {
+    return ErrNodeAlreadyExist
+  }
+  if err := mt.mkdirAll(path.Dir(dst)); err != nil {
+    return err
+  }
+  if err := mt.Delete(src); err != nil {
+    return err
+  }
+  nodeName := path.Base(dst)
+  op := func(parent *MemTreeNode) (changed bool, ret interface{}, err error) {
+    parent.Children[nodeName] = node.(*MemTreeNode)
+    changed = true
+    return
+  }
+  _, err = mt.apply(path.Dir(dst), op)
+  return err
+}
+
+// Replaces the node of the given path with the node of the same path in src tree. If
+// src doesn't have the path, the node is deleted.
+func (mt *MemTree) CopyFrom(src Tree, treePath string) error {
+  if treePath == "/" {
+    mt.Clear()
+  } else if err := mt.Delete(treePath); err != nil && err != ErrPathNotExist {
+    return err
+  }
+  copyFn := func(nodePath string, node Node) error {
+    if nodePath == "/" {
+      return nil
+    }
+    if node.IsDir() {
+      return mt.mkdirAll(nodePath)
+    }
+    return mt.MkFileAllMode(nodePath, node.GetHashValue(), node.GetMode())
+  }
+  err := src.Traverse(copyFn, treePath)
+  if err == ErrPathNotExist {
+    return nil
+  }
+  return err
+}
+
 // Clear all the nodes except the root node.
 func (mt *MemTree) Clear() {
   mt.root = newDirMemTreeNode()
@@ -181,18 +258,26 @@ func (mt *MemTree) mkdirAll(dir string) error {
   return mt.MkDir(dir)
 }
 
+// A node of the serialized MemTree, Hash is nil for directories. Mode is omitted for
+// regular files so trees serialized before modes existed are read the same.
+type serializedNode struct {
+  Path string
+  Hash []byte
+  Mode FileMode `json:",omitempty"`
+}
+
 // Serializes the MemTree to byte array.
 func (mt *MemTree) Serialize() ([]byte, error) {
-  type tuple struct {
-    Path string `json:path`
-    Hash []byte `json:hash`
-  }
-  nodes := make([]tuple, 0)
+  nodes := make([]serializedNode, 0)
   traverseFn := func(treePath string, node Node) error {
     if !node.IsDir() {
-      nodes = append(nodes, tuple{treePath, node.GetHashValue()})
+      entry := serializedNode{Path : treePath, Hash : node.GetHashValue()}
+      if mode := node.GetMode(); mode != ModeRegular {
+        entry.Mode = mode
+      }
+      nodes = append(nodes, entry)
     } else {
-      nodes = append(nodes, tuple{treePath, nil})
+      nodes = append(nodes, serializedNode{Path : treePath})
     }
     return nil
   }
@@ -211,11 +296,7 @@ func NewMemTree() *MemTree {
 
 // Deserializes the byte array to MemTree.
 func Deserialize(data []byte) (*MemTree, error) {
-  type tuple struct {
-    Path string `json:path`
-    Hash []byte `json:hash`
-  }
-  nodes := make([]tuple, 0)
+  nodes := make([]serializedNode, 0)
   err := json.Unmarshal(data, &nodes)
   if err != nil {
     return nil, err
@@ -223,7 +304,11 @@ func Deserialize(data []byte) (*MemTree, error) {
   tree := NewMemTree()
   for _, t := range(nodes) {
     if t.Hash != nil {
-      tree.MkFileAll(t.Path, t.Hash)
+      mode := t.Mode
+      if mode == 0 {
+        mode = ModeRegular
+      }
+      tree.MkFileAllMode(t.Path, t.Hash, mode)
     } else {
       tree.MkDirAll(t.Path)
     }
@@ -289,10 +374,12 @@ type MemTreeNode struct {
   Hash [HashSize]byte
   // The children of the node if it's the directory.
   Children map[string]*MemTreeNode
+  // The mode of the file, it's not used for directories.
+  Mode FileMode
 }
 
 func newDirMemTreeNode() *MemTreeNode {
-  return &MemTreeNode{true, EmptyDirHash, make(map[string]*MemTreeNode)}
+  return &MemTreeNode{Dir : true, Hash : EmptyDirHash, Children : make(map[string]*MemTreeNode)}
 }
 
 func newFileMemTreeNode(hash []byte) *MemTreeNode {
@@ -301,7 +388,7 @@ func newFileMemTreeNode(hash []byte) *MemTreeNode {
   }
   var hashArr  [HashSize]byte
   copy(hashArr[:], hash)
-  return &MemTreeNode{false, hashArr, nil}
+  return &MemTreeNode{Dir : false, Hash : hashArr, Mode : ModeRegular}
 }
 
 func (n *MemTreeNode) GetHashValue() []byte {
@@ -320,6 +407,16 @@ func (n *MemTreeNode) IsDir() bool {
   return n.Dir
 }
 
+func (n *MemTreeNode) GetMode() FileMode {
+  if n.Dir {
+    return ModeDir
+  }
+  if n.Mode == 0 {
+    return ModeRegular
+  }
+  return n.Mode
+}
+
 func (n *MemTreeNode) updateHashValue() {
   if n.Dir {
     hash, _, _ := WrapData(TreeType, []byte(GetDirString(n)))
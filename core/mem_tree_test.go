@@ -276,3 +276,85 @@ func TestSerialization(t *testing.T) {
     t.Error("Inconsistency after serialization/deserialization.")
   }
 }
+
+func TestMemTreeCopyFrom(t *testing.T) {
+  src := NewMemTree()
+  src.MkFileAll("/d1/f1", generateRandomHash())
+  src.MkFileAll("/d1/d2/f2", generateRandomHash())
+  src.MkFileAll("/f3", generateRandomHash())
+  src.MkDirAll("/empty")
+
+  dst := NewMemTree()
+  dst.MkFileAll("/d1/other", generateRandomHash())
+  dst.MkFileAll("/f4", generateRandomHash())
+  if err := dst.CopyFrom(src, "/d1"); err != nil {
+    t.Fatal("Failed to copy /d1:", err)
+  }
+  if _, err := dst.Get("/d1/other"); err != ErrPathNotExist {
+    t.Error("/d1/other should be replaced")
+  }
+  node1, _ := dst.Get("/d1")
+  node2, _ := src.Get("/d1")
+  if hex.EncodeToString(node1.GetHashValue()) != hex.EncodeToString(node2.GetHashValue()) {
+    t.Error("/d1 is not copied correctly")
+  }
+  // Paths which don't exist in src are deleted.
+  if err := dst.CopyFrom(src, "/f4"); err != nil {
+    t.Error("Failed to copy /f4:", err)
+  }
+  if _, err := dst.Get("/f4"); err != ErrPathNotExist {
+    t.Error("/f4 should be deleted")
+  }
+  // Copying root makes two trees identical.
+  dst.CopyFrom(src, "/")
+  m1, m2, diffes := CompareTrees(src, dst)
+  if len(m1) != 0 || len(m2) != 0 || len(diffes) != 0 ||
+     hex.EncodeToString(src.GetHash()) != hex.EncodeToString(dst.GetHash()) {
+    t.Error("Inconsistency between two trees.")
+  }
+}
+
+func TestMemTreeMove(t *testing.T) {
+  tree := NewMemTree()
+  tree.MkFileAll("/d1/f1", generateRandomHash())
+  tree.MkFileAll("/d1/d2/f2", generateRandomHash())
+  tree.MkFileAll("/f3", generateRandomHash())
+  expected := NewMemTree()
+  expected.CopyFrom(tree, "/")
+
+  node, _ := tree.Get("/d1")
+  hash := hex.EncodeToString(node.GetHashValue())
+  if err := tree.Move("/d1", "/a/b"); err != nil {
+    t.Fatal("Failed to move /d1:", err)
+  }
+  if _, err := tree.Get("/d1"); err != ErrPathNotExist {
+    t.Error("/d1 should be moved away")
+  }
+  if node, err := tree.Get("/a/b/d2/f2"); err != nil || node.IsDir() {
+    t.Error("The subtree of /d1 should be moved to /a/b")
+  }
+  node, _ = tree.Get("/a/b")
+  if hex.EncodeToString(node.GetHashValue()) != hash {
+    t.Error("The hash of the moved directory shouldn't change")
+  }
+
+  if err := tree.Move("/a/b", "/a/b/c"); err != ErrInvalidPath {
+    t.Error("Expecting ErrInvalidPath for moving a directory into itself")
+  }
+  if err := tree.Move("/f3", "/a/b/f1"); err != ErrNodeAlreadyExist {
+    t.Error("Expecting ErrNodeAlreadyExist for an existing destination")
+  }
+  if err := tree.Move("/missing", "/x"); err != ErrPathNotExist {
+    t.Error("Expecting ErrPathNotExist for a missing source")
+  }
+  if err := tree.Move("/f3", "/f3/x"); err != ErrInvalidPath {
+    t.Error("Expecting ErrInvalidPath for moving a file under itself")
+  }
+
+  // Moving it back restores the tree.
+  tree.Move("/a/b", "/d1")
+  tree.Delete("/a")
+  if hex.EncodeToString(tree.GetHash()) != hex.EncodeToString(expected.GetHash()) {
+    t.Error("The tree isn't restored after moving back")
+  }
+}
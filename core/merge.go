@@ -0,0 +1,310 @@
+package core
+
+import (
+  "bytes"
+  "path"
+  "sort"
+)
+
+// The kind of a conflict found by three-way merge.
+type ConflictKind int
+
+const (
+  // Both sides changed the content of the file differently.
+  ConflictContent ConflictKind = iota
+  // One side changed the file while the other side deleted it.
+  ConflictModifyDelete
+  // Both sides added the file with different content.
+  ConflictAddAdd
+  // One side has a file where the other side has a directory.
+  ConflictFileDir
+)
+
+// Converts the kind of conflict to readable string.
+func (kind ConflictKind) String() string {
+  switch kind {
+  case ConflictModifyDelete:
+    return "modified/deleted"
+  case ConflictAddAdd:
+    return "both added"
+  case ConflictFileDir:
+    return "file/directory"
+  }
+  return "both modified"
+}
+
+// A path which can't be merged automatically. Base, Ours and Theirs are the hashes of the
+// file in the three trees, nil if the file doesn't exist in the tree. Content is the data
+// to leave in working directory for users to resolve the conflict.
+type MergeConflict struct {
+  Path string
+  Kind ConflictKind
+  Base []byte
+  Ours []byte
+  Theirs []byte
+  Content []byte
+}
+
+// The labels of the two sides in conflict markers.
+type MergeLabels struct {
+  Ours string
+  Theirs string
+}
+
+// Merges two versions of lines which were both changed from base. The lines are split by
+// SplitLines. Changes which overlap and are not identical are kept as conflicts marked
+// with "<<<<<<<", "=======" and ">>>>>>>". Returns the merged lines and whether there are
+// conflicts.
+func MergeLines(base, ours, theirs []string, labels MergeLabels) ([]string, bool) {
+  type sideChange struct {
+    LineChange
+    side int
+  }
+  all := make([]sideChange, 0)
+  for _, c := range(GetLineChanges(base, ours)) {
+    all = append(all, sideChange{c, 0})
+  }
+  for _, c := range(GetLineChanges(base, theirs)) {
+    all = append(all, sideChange{c, 1})
+  }
+  sort.SliceStable(all, func(i, j int) bool {
+    return all[i].AStart < all[j].AStart
+  })
+
+  // Applies the changes of one side to base[start:end].
+  apply := func(group []sideChange, side, start, end int) []string {
+    lines := make([]string, 0)
+    pos := start
+    for _, c := range(group) {
+      if c.side == side {
+        lines = append(lines, base[pos:c.AStart]...)
+        lines = append(lines, c.Lines...)
+        pos = c.AEnd
+      }
+    }
+    return append(lines, base[pos:end]...)
+  }
+
+  merged := make([]string, 0, len(base))
+  conflict := false
+  pos := 0
+  for i := 0; i < len(all); {
+    // Groups the changes which overlap with each other. Two insertions at the same place,
+    // or an insertion right at the border of a change are treated as overlapping.
+    start, end := all[i].AStart, all[i].AEnd
+    j := i + 1
+    for j < len(all) && (all[j].AStart < end ||
+        (all[j].AStart == end && (all[j].AStart == all[j].AEnd || start == end))) {
+      if all[j].AEnd > end {
+        end = all[j].AEnd
+      }
+      j++
+    }
+    group := all[i:j]
+    merged = append(merged, base[pos:start]...)
+    sides := 0
+    for _, c := range(group) {
+      sides |= 1 << uint(c.side)
+    }
+    oursLines := apply(group, 0, start, end)
+    theirsLines := apply(group, 1, start, end)
+    if sides != 3 {
+      if sides == 1 {
+        merged = append(merged, oursLines...)
+      } else {
+        merged = append(merged, theirsLines...)
+      }
+    } else if equalLines(oursLines, theirsLines) {
+      merged = append(merged, oursLines...)
+    } else {
+      conflict = true
+      merged = append(merged, "<<<<<<< " + labels.Ours + "\n")
+      merged = appendWithNewline(merged, oursLines)
+      merged = append(merged, "=======\n")
+      merged = appendWithNewline(merged, theirsLines)
+      merged = append(merged, ">>>>>>> " + labels.Theirs + "\n")
+    }
+    pos = end
+    i = j
+  }
+  merged = append(merged, base[pos:]...)
+  return merged, conflict
+}
+
+// Merges the changes from base to theirs into ours. Blobs of merged files are stored in
+// CAStore. The returned tree is ours with the changes applied, the conflicted paths keep
+// the version of ours in it.
+func MergeTrees(base, ours, theirs Tree, labels MergeLabels) (*MemTree, []MergeConflict, error) {
+  result := NewMemTree()
+  if err := result.CopyFrom(ours, "/"); err != nil {
+    return nil, nil, err
+  }
+  baseFiles, oursFiles, theirsFiles := flattenTree(base), flattenTree(ours), flattenTree(theirs)
+  baseModes, oursModes, theirsModes := flattenModes(base), flattenModes(ours),
+                                       flattenModes(theirs)
+  paths := make([]string, 0, len(oursFiles))
+  seen := make(map[string]bool)
+  for _, files := range([]map[string][]byte{baseFiles, oursFiles, theirsFiles}) {
+    for p, _ := range(files) {
+      if !seen[p] {
+        seen[p] = true
+        paths = append(paths, p)
+      }
+    }
+  }
+  sort.Strings(paths)
+
+  conflicts := make([]MergeConflict, 0)
+  for _, p := range(paths) {
+    b, o, t := baseFiles[p], oursFiles[p], theirsFiles[p]
+    // The mode is merged separately, takes theirs if only theirs changed it.
+    mode := oursModes[p]
+    if mode == baseModes[p] && theirsModes[p] != 0 {
+      mode = theirsModes[p]
+    }
+    if bytes.Equal(o, t) || bytes.Equal(b, t) {
+      // Theirs doesn't change the content, or both sides made the same change.
+      if o != nil && mode != oursModes[p] {
+        if err := result.MkFileAllMode(p, o, mode); err != nil {
+          return nil, nil, err
+        }
+      }
+      continue
+    }
+    conflict := MergeConflict{Path : p, Base : b, Ours : o, Theirs : t}
+    if bytes.Equal(b, o) {
+      // Only theirs changed the file, takes theirs.
+      var err error
+      if t == nil {
+        err = deleteFileAndEmptyParents(result, theirs, p)
+      } else {
+        err = result.MkFileAllMode(p, t, mode)
+      }
+      if err != nil {
+        // Theirs has a file where ours has a directory, or vice versa.
+        conflict.Kind = ConflictFileDir
+        conflicts = append(conflicts, conflict)
+      }
+      continue
+    }
+    // Both sides changed the file differently.
+    if o == nil || t == nil {
+      conflict.Kind = ConflictModifyDelete
+      conflict.Content, _ = getBlobData(o)
+      if o == nil {
+        conflict.Content, _ = getBlobData(t)
+      }
+      conflicts = append(conflicts, conflict)
+      continue
+    }
+    if b == nil {
+      conflict.Kind = ConflictAddAdd
+    }
+    baseData, err := getBlobData(b)
+    if err != nil {
+      return nil, nil, err
+    }
+    oursData, err := getBlobData(o)
+    if err != nil {
+      return nil, nil, err
+    }
+    theirsData, err := getBlobData(t)
+    if err != nil {
+      return nil, nil, err
+    }
+    if IsBinary(baseData) || IsBinary(oursData) || IsBinary(theirsData) {
+      // Binary files can't be merged, keeps ours.
+      conflict.Content = oursData
+      conflicts = append(conflicts, conflict)
+      continue
+    }
+    lines, hasConflict := MergeLines(SplitLines(baseData), SplitLines(oursData),
+                                     SplitLines(theirsData), labels)
+    if hasConflict {
+      conflict.Content = JoinLines(lines)
+      conflicts = append(conflicts, conflict)
+      continue
+    }
+    hash, err := GetCAStore().StoreBlob(JoinLines(lines))
+    if err != nil {
+      return nil, nil, err
+    }
+    if err = result.MkFileAllMode(p, hash, mode); err != nil {
+      return nil, nil, err
+    }
+  }
+  return result, conflicts, nil
+}
+
+// Gets all the files of the tree, mapping from path to hash.
+func flattenTree(tree Tree) map[string][]byte {
+  files := make(map[string][]byte)
+  tree.Traverse(func(treePath string, node Node) error {
+    if !node.IsDir() {
+      files[treePath] = node.GetHashValue()
+    }
+    return nil
+  }, "/")
+  return files
+}
+
+// Gets the modes of all the files of the tree, mapping from path to mode.
+func flattenModes(tree Tree) map[string]FileMode {
+  modes := make(map[string]FileMode)
+  tree.Traverse(func(treePath string, node Node) error {
+    if !node.IsDir() {
+      modes[treePath] = node.GetMode()
+    }
+    return nil
+  }, "/")
+  return modes
+}
+
+// Deletes the file from tree, the parent directories which become empty are also deleted
+// unless they exist in keep tree.
+func deleteFileAndEmptyParents(tree *MemTree, keep Tree, treePath string) error {
+  if err := tree.Delete(treePath); err != nil {
+    return err
+  }
+  for dir := path.Dir(treePath); dir != "/"; dir = path.Dir(dir) {
+    node, err := tree.Get(dir)
+    if err != nil || len(node.GetChildren()) != 0 {
+      break
+    }
+    if _, err := keep.Get(dir); err == nil {
+      break
+    }
+    tree.Delete(dir)
+  }
+  return nil
+}
+
+// Gets the data of the blob, nil hash gives empty data.
+func getBlobData(hash []byte) ([]byte, error) {
+  if hash == nil {
+    return []byte{}, nil
+  }
+  return GetCAStore().GetBlob(hash)
+}
+
+func equalLines(a, b []string) bool {
+  if len(a) != len(b) {
+    return false
+  }
+  for i := range(a) {
+    if a[i] != b[i] {
+      return false
+    }
+  }
+  return true
+}
+
+// Appends the lines and makes sure the last one ends with "\n" so a conflict marker
+// can follow.
+func appendWithNewline(dst, lines []string) []string {
+  dst = append(dst, lines...)
+  if n := len(dst); n > 0 && dst[n - 1][len(dst[n - 1]) - 1] != '\n' {
+    dst[n - 1] += "\n"
+  }
+  return dst
+}
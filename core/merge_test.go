@@ -0,0 +1,150 @@
+package core
+
+import (
+  "math/rand"
+  "strings"
+  "testing"
+)
+
+func linesOf(s string) []string {
+  return SplitLines([]byte(s))
+}
+
+func TestDiffLines(t *testing.T) {
+  r := rand.New(rand.NewSource(1))
+  randomLines := func() []string {
+    lines := make([]string, r.Intn(20))
+    for i := range(lines) {
+      lines[i] = string('a' + rune(r.Intn(5))) + "\n"
+    }
+    return lines
+  }
+  for round := 0; round < 200; round++ {
+    a, b := randomLines(), randomLines()
+    ops := DiffLines(a, b)
+    // Rebuilds both sides from the ops.
+    var ra, rb []string
+    for _, op := range(ops) {
+      if op.Kind != DiffInsert {
+        if a[op.ALine] != op.Text {
+          t.Fatal("Incorrect line index of old text")
+        }
+        ra = append(ra, op.Text)
+      }
+      if op.Kind != DiffDelete {
+        if b[op.BLine] != op.Text {
+          t.Fatal("Incorrect line index of new text")
+        }
+        rb = append(rb, op.Text)
+      }
+    }
+    if !equalLines(ra, a) || !equalLines(rb, b) {
+      t.Fatalf("Diff of %q and %q doesn't cover both texts", a, b)
+    }
+  }
+  ops := DiffLines(linesOf("a\nb\nc\n"), linesOf("a\nx\nc\n"))
+  if len(ops) != 4 || ops[1].Kind != DiffDelete || ops[2].Kind != DiffInsert {
+    t.Error("Expecting b to be replaced by x")
+  }
+  hunks := GetHunks(DiffLines(linesOf("1\n2\n3\n4\n5\n6\n7\n8\n9\n"),
+                              linesOf("1\nx\n3\n4\n5\n6\n7\n8\ny\n")), 1)
+  if len(hunks) != 2 || hunks[0].AStart != 0 || hunks[0].ALen != 3 || hunks[1].AStart != 7 {
+    t.Error("Incorrect hunks:", hunks)
+  }
+}
+
+func TestMergeLines(t *testing.T) {
+  labels := MergeLabels{"ours", "theirs"}
+  base := linesOf("1\n2\n3\n4\n5\n")
+  // Changes to different lines merge cleanly.
+  merged, conflict := MergeLines(base, linesOf("1\nA\n3\n4\n5\n"), linesOf("1\n2\n3\nB\n5\n"), labels)
+  if conflict || string(JoinLines(merged)) != "1\nA\n3\nB\n5\n" {
+    t.Errorf("Unexpected merge result %q", JoinLines(merged))
+  }
+  // Identical changes on both sides.
+  merged, conflict = MergeLines(base, linesOf("1\nA\n3\n4\n5\n"), linesOf("1\nA\n3\n4\n5\n6\n"), labels)
+  if conflict || string(JoinLines(merged)) != "1\nA\n3\n4\n5\n6\n" {
+    t.Errorf("Unexpected merge result %q", JoinLines(merged))
+  }
+  // Different changes to the same line conflict.
+  merged, conflict = MergeLines(base, linesOf("1\nA\n3\n4\n5\n"), linesOf("1\nB\n3\n4\n5"), labels)
+  expected := "1\n<<<<<<< ours\nA\n=======\nB\n>>>>>>> theirs\n3\n4\n5"
+  if !conflict || string(JoinLines(merged)) != expected {
+    t.Errorf("Unexpected merge result %q", JoinLines(merged))
+  }
+  // Missing newline at the end of a conflicted region.
+  merged, conflict = MergeLines(linesOf("x"), linesOf("y"), linesOf("z"), labels)
+  if !conflict || !strings.Contains(string(JoinLines(merged)), "y\n=======\nz\n>>>>>>>") {
+    t.Errorf("Unexpected merge result %q", JoinLines(merged))
+  }
+}
+
+func TestMergeTrees(t *testing.T) {
+  if _, err := initTestRepo("merge_trees_test"); err != nil {
+    t.Fatal(err)
+  }
+  store := GetCAStore()
+  mkTree := func(files map[string]string) *MemTree {
+    tree := NewMemTree()
+    for p, content := range(files) {
+      hash, _ := store.StoreBlob([]byte(content))
+      tree.MkFileAll(p, hash)
+    }
+    return tree
+  }
+  base := mkTree(map[string]string{
+    "/a" : "1\n2\n3\n", "/b" : "b\n", "/c" : "c\n", "/d/e" : "e\n", "/m" : "m\n",
+  })
+  ours := mkTree(map[string]string{
+    "/a" : "1\nX\n3\n", "/b" : "b\n", "/c" : "c\n", "/d/e" : "e\n", "/m" : "m2\n",
+  })
+  theirs := mkTree(map[string]string{
+    "/a" : "1\n2\nY\n", "/c" : "c2\n", "/new" : "new\n", "/m" : "m3\n",
+  })
+  result, conflicts, err := MergeTrees(base, ours, theirs, MergeLabels{"ours", "theirs"})
+  if err != nil {
+    t.Fatal(err)
+  }
+  expected := mkTree(map[string]string{
+    "/a" : "1\nX\nY\n", "/c" : "c2\n", "/new" : "new\n", "/m" : "m2\n",
+  })
+  m1, m2, diffes := CompareTrees(expected, result)
+  if len(m1) != 0 || len(m2) != 0 || len(diffes) != 0 {
+    t.Error("Unexpected merge result", m1, m2, diffes)
+  }
+  if len(conflicts) != 1 || conflicts[0].Path != "/m" || conflicts[0].Kind != ConflictContent {
+    t.Fatal("Expecting conflict in /m", conflicts)
+  }
+  if !strings.Contains(string(conflicts[0].Content), "m2\n=======\nm3\n") {
+    t.Errorf("Unexpected conflict content %q", conflicts[0].Content)
+  }
+}
+
+func TestUnmergedPaths(t *testing.T) {
+  if _, err := initTestRepo("unmerged_paths_test"); err != nil {
+    t.Fatal(err)
+  }
+  WriteConflicts([]UnmergedPath{{"/d/b", ConflictModifyDelete}, {"/a", ConflictContent},
+                                {"/d/c", ConflictAddAdd}})
+  unmerged := ReadUnmergedPaths()
+  if len(unmerged) != 3 || unmerged[0] != (UnmergedPath{"/a", ConflictContent}) ||
+     unmerged[1] != (UnmergedPath{"/d/b", ConflictModifyDelete}) {
+    t.Error("Unexpected unmerged paths", unmerged)
+  }
+  if paths := ReadConflicts(); len(paths) != 3 || paths[2] != "/d/c" {
+    t.Error("Unexpected conflicts", paths)
+  }
+  ResolveConflicts("/d")
+  if unmerged := ReadUnmergedPaths(); len(unmerged) != 1 || unmerged[0].Path != "/a" {
+    t.Error("Conflicts under /d should be resolved", unmerged)
+  }
+  // An invalid conflicts file has no conflicts.
+  WriteStateFile(MergeConflictsFile, []byte(`["/x"]`))
+  if unmerged := ReadUnmergedPaths(); len(unmerged) != 0 {
+    t.Error("Expecting no unmerged paths for an invalid file", unmerged)
+  }
+  WriteConflicts(nil)
+  if len(ReadConflicts()) != 0 {
+    t.Error("Expecting no conflicts")
+  }
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+  "fmt"
+  "os"
+  "strconv"
+)
+
+// The mode of an entry in trees, the values are the same as git.
+type FileMode uint32
+
+const (
+  ModeDir FileMode = 0040000
+  ModeRegular FileMode = 0100644
+  ModeExec FileMode = 0100755
+  ModeSymlink FileMode = 0120000
+  // A nested repository, the hash is the commit it's at.
+  ModeGitlink FileMode = 0160000
+)
+
+// Converts the mode to octal string, e.g. 100644.
+func (mode FileMode) String() string {
+  return fmt.Sprintf("%06o", uint32(mode))
+}
+
+// Checks whether the entry with the mode has its content in a blob.
+func (mode FileMode) IsBlob() bool {
+  return mode == ModeRegular || mode == ModeExec || mode == ModeSymlink
+}
+
+// Gets the permission bits of the file in working directory.
+func (mode FileMode) Perm() os.FileMode {
+  if mode == ModeExec {
+    return 0755
+  }
+  return 0644
+}
+
+// Parses the octal string of the mode.
+func ParseFileMode(s string) (FileMode, error) {
+  n, err := strconv.ParseUint(s, 8, 32)
+  if err != nil {
+    return 0, ErrInvalidMode
+  }
+  switch mode := FileMode(n); mode {
+  case ModeDir, ModeRegular, ModeExec, ModeSymlink, ModeGitlink:
+    return mode, nil
+  }
+  return 0, ErrInvalidMode
+}
+
+// Gets the mode of the file from its info in working directory, regular files are
+// executable if the owner can execute them.
+func fileModeOf(fi os.FileInfo) FileMode {
+  switch {
+  case fi.IsDir():
+    return ModeDir
+  case fi.Mode() & os.ModeSymlink != 0:
+    return ModeSymlink
+  case fi.Mode() & 0100 != 0:
+    return ModeExec
+  }
+  return ModeRegular
+}
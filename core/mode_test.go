@@ -0,0 +1,129 @@
+package core
+
+import (
+  "bytes"
+  "os"
+  "testing"
+)
+
+func TestFileModes(t *testing.T) {
+  if _, err := initTestRepo("mode_test"); err != nil {
+    t.Fatal(err)
+  }
+  store := GetCAStore()
+  hash, _ := store.StoreBlob([]byte("#!/bin/sh\n"))
+  tree := NewMemTree()
+  tree.MkFileAll("/a", hash)
+  regularHash := append([]byte{}, tree.GetHash()...)
+  tree.MkFileAllMode("/a", hash, ModeExec)
+  tree.MkFileAllMode("/dir/b", hash, ModeExec)
+  if bytes.Equal(tree.GetHash(), regularHash) {
+    t.Error("Changing the mode should change the hash of the tree")
+  }
+  if _, _, diffes := CompareTrees(tree, tree); len(diffes) != 0 {
+    t.Error("Unexpected differences", diffes)
+  }
+
+  // The modes are kept by serialization and CATree.
+  data, _ := tree.Serialize()
+  restored, err := Deserialize(data)
+  if err != nil {
+    t.Fatal(err)
+  }
+  caTree, err := BuildCATree(tree)
+  if err != nil {
+    t.Fatal(err)
+  }
+  for _, other := range([]Tree{restored, caTree}) {
+    if !bytes.Equal(other.GetHash(), tree.GetHash()) {
+      t.Error("The hash should be kept")
+    }
+    if node, _ := other.Get("/dir/b"); node.GetMode() != ModeExec {
+      t.Errorf("Expecting mode %s, got %s", ModeExec, node.GetMode())
+    }
+    if node, _ := other.Get("/dir"); !node.IsDir() || node.GetMode() != ModeDir {
+      t.Error("Expecting /dir to be directory")
+    }
+  }
+
+  // A mode-only change is a difference between trees.
+  regular := NewMemTree()
+  regular.MkFileAll("/a", hash)
+  regular.MkFileAll("/dir/b", hash)
+  if _, _, diffes := CompareTrees(regular, tree); len(diffes) != 2 {
+    t.Error("Expecting mode changes of /a and /dir/b", diffes)
+  }
+
+  // The mode in working directory comes from the permission of the file.
+  if err = createTempFiles(".", map[string][]byte{"run" : []byte("#!/bin/sh\n")}); err != nil {
+    t.Fatal(err)
+  }
+  fsTree = nil
+  if node, _ := GetFsTree().Get("/run"); node.GetMode() != ModeRegular {
+    t.Errorf("Expecting mode %s, got %s", ModeRegular, node.GetMode())
+  }
+  os.Chmod("run", 0755)
+  GetFsTree().ClearCache()
+  if node, _ := GetFsTree().Get("/run"); node.GetMode() != ModeExec {
+    t.Errorf("Expecting mode %s, got %s", ModeExec, node.GetMode())
+  }
+
+  // Merging takes the mode changed by theirs along with the content changed by ours.
+  other, _ := store.StoreBlob([]byte("#!/bin/bash\n"))
+  ours := NewMemTree()
+  ours.MkFileAll("/a", other)
+  result, conflicts, err := MergeTrees(regular, ours, tree, MergeLabels{"ours", "theirs"})
+  if err != nil || len(conflicts) != 0 {
+    t.Fatal("Unexpected merge failure", err, conflicts)
+  }
+  if node, _ := result.Get("/a"); node.GetMode() != ModeExec ||
+     !bytes.Equal(node.GetHashValue(), other) {
+    t.Error("Expecting the content of ours with the mode of theirs")
+  }
+}
+
+func TestParseFileMode(t *testing.T) {
+  if mode, err := ParseFileMode("100755"); err != nil || mode != ModeExec {
+    t.Error("Failed to parse 100755", mode, err)
+  }
+  for _, s := range([]string{"100777", "blob", ""}) {
+    if _, err := ParseFileMode(s); err != ErrInvalidMode {
+      t.Errorf("Expecting ErrInvalidMode for %q", s)
+    }
+  }
+}
+
+func TestSymlinks(t *testing.T) {
+  if _, err := initTestRepo("symlink_test"); err != nil {
+    t.Fatal(err)
+  }
+  if err := createTempFiles(".", map[string][]byte{"dir/a" : []byte("a")}); err != nil {
+    t.Fatal(err)
+  }
+  os.Symlink("dir", "link")
+  os.Symlink("nowhere", "dangling")
+  fsTree = nil
+  tree := GetFsTree()
+  for _, treePath := range([]string{"/link", "/dangling"}) {
+    node, err := tree.Get(treePath)
+    if err != nil {
+      t.Fatal(err)
+    }
+    if node.IsDir() || node.GetMode() != ModeSymlink {
+      t.Errorf("Expecting %s to be symlink", treePath)
+    }
+  }
+  // The blob of a symlink is its target.
+  node, _ := tree.Get("/link")
+  if data, _ := node.GetData(); string(data) != "dir" {
+    t.Errorf("Unexpected target %q", data)
+  }
+  hash, _, _ := WrapData(BlobType, []byte("dir"))
+  if !bytes.Equal(node.GetHashValue(), hash[:]) {
+    t.Error("The hash of symlink should be the hash of its target")
+  }
+  root, _ := tree.Get("/")
+  if children := root.GetChildren(); len(children) != 3 {
+    t.Error("Unexpected children", children)
+  }
+}
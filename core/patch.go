@@ -0,0 +1,145 @@
+package core
+
+import (
+  "errors"
+  "strings"
+)
+
+var ErrHunkNotApply = errors.New("core: hunk doesn't apply")
+
+// Splits the hunk to smaller ones at the unchanged lines between its changes, each with
+// up to the given number of context lines. The hunk is returned as is if it has only one
+// run of changes. Context lines may be shared by adjacent hunks.
+func SplitHunk(hunk Hunk, context int) []Hunk {
+  // The [start, end) ranges of the runs of changed ops.
+  type run struct{ start, end int }
+  runs := make([]run, 0)
+  for idx := 0; idx < len(hunk.Ops); idx++ {
+    if hunk.Ops[idx].Kind == DiffEqual {
+      continue
+    }
+    r := run{start : idx}
+    for idx < len(hunk.Ops) && hunk.Ops[idx].Kind != DiffEqual {
+      idx++
+    }
+    r.end = idx
+    runs = append(runs, r)
+  }
+  if len(runs) <= 1 {
+    return []Hunk{hunk}
+  }
+  hunks := make([]Hunk, 0, len(runs))
+  for i, r := range(runs) {
+    // The context lines can't go beyond the changes of adjacent runs.
+    from, to := 0, len(hunk.Ops)
+    if i > 0 {
+      from = r.start - context
+      if from < runs[i - 1].end {
+        from = runs[i - 1].end
+      }
+    }
+    if i < len(runs) - 1 {
+      to = r.end + context
+      if to > runs[i + 1].start {
+        to = runs[i + 1].start
+      }
+    }
+    sub := Hunk{AStart : hunk.AStart, BStart : hunk.BStart, Ops : hunk.Ops[from:to]}
+    for _, op := range(hunk.Ops[:from]) {
+      if op.Kind != DiffInsert {
+        sub.AStart++
+      }
+      if op.Kind != DiffDelete {
+        sub.BStart++
+      }
+    }
+    for _, op := range(sub.Ops) {
+      if op.Kind != DiffInsert {
+        sub.ALen++
+      }
+      if op.Kind != DiffDelete {
+        sub.BLen++
+      }
+    }
+    hunks = append(hunks, sub)
+  }
+  return hunks
+}
+
+// Applies the hunks to the lines, the hunks must be sorted and their changes must not
+// overlap, but they can share context lines.
+func ApplyHunks(lines []string, hunks []Hunk) []string {
+  result := make([]string, 0, len(lines))
+  // The index of the next line to copy.
+  pos := 0
+  for _, hunk := range(hunks) {
+    for _, op := range(hunk.Ops) {
+      if op.Kind == DiffInsert {
+        result = append(result, op.Text)
+        continue
+      }
+      if op.ALine < pos {
+        // The context line has been copied by the previous hunk.
+        continue
+      }
+      result = append(result, lines[pos:op.ALine]...)
+      if op.Kind == DiffEqual {
+        result = append(result, lines[op.ALine])
+      }
+      pos = op.ALine + 1
+    }
+  }
+  return append(result, lines[pos:]...)
+}
+
+// Parses the hunk edited from the original hunk of the lines. The body has a line for
+// each op prefixed with " ", "-" or "+", the header lines starting with "@" are skipped.
+// The context and deleted lines must match the original lines from where the original
+// hunk starts, otherwise ErrHunkNotApply is returned.
+func ParseHunk(body string, lines []string, original Hunk) (Hunk, error) {
+  hunk := Hunk{AStart : original.AStart, BStart : original.BStart, Ops : make([]DiffOp, 0)}
+  aLine, bLine := original.AStart, original.BStart
+  for _, row := range(SplitLines([]byte(body))) {
+    if row == "\n" {
+      // Editors may strip the space of empty context lines.
+      row = " \n"
+    }
+    op := DiffOp{Text : row[1:], ALine : -1, BLine : -1}
+    switch row[0] {
+    case '@':
+      continue
+    case '\\':
+      // The previous line doesn't end with newline.
+      if len(hunk.Ops) > 0 {
+        last := &hunk.Ops[len(hunk.Ops) - 1]
+        last.Text = strings.TrimSuffix(last.Text, "\n")
+      }
+      continue
+    case ' ':
+      op.Kind = DiffEqual
+    case '-':
+      op.Kind = DiffDelete
+    case '+':
+      op.Kind = DiffInsert
+    default:
+      return Hunk{}, ErrHunkNotApply
+    }
+    if op.Kind != DiffInsert {
+      op.ALine = aLine
+      aLine++
+      hunk.ALen++
+    }
+    if op.Kind != DiffDelete {
+      op.BLine = bLine
+      bLine++
+      hunk.BLen++
+    }
+    hunk.Ops = append(hunk.Ops, op)
+  }
+  for _, op := range(hunk.Ops) {
+    if op.Kind != DiffInsert && (op.ALine >= len(lines) || lines[op.ALine] != op.Text) {
+      return Hunk{}, ErrHunkNotApply
+    }
+  }
+  return hunk, nil
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+  "math/rand"
+  "testing"
+)
+
+func TestSplitAndApplyHunks(t *testing.T) {
+  a := linesOf("1\n2\n3\n4\n5\n6\n7\n8\n9\n")
+  b := linesOf("1\nx\n3\n4\n5\n6\n7\ny\n9\n")
+  hunks := GetHunks(DiffLines(a, b), 3)
+  if len(hunks) != 1 {
+    t.Fatal("Expecting one hunk, got", len(hunks))
+  }
+  subs := SplitHunk(hunks[0], 3)
+  if len(subs) != 2 {
+    t.Fatal("Expecting two hunks after splitting, got", len(subs))
+  }
+  if subs[0].AStart != 0 || subs[0].ALen != 5 || subs[1].AStart != 4 || subs[1].ALen != 5 {
+    t.Error("Unexpected ranges of split hunks", subs[0].AStart, subs[0].ALen,
+            subs[1].AStart, subs[1].ALen)
+  }
+  if got := string(JoinLines(ApplyHunks(a, subs))); got != string(JoinLines(b)) {
+    t.Error("Applying all split hunks should give the new text, got", got)
+  }
+  if got := string(JoinLines(ApplyHunks(a, subs[1:]))); got != "1\n2\n3\n4\n5\n6\n7\ny\n9\n" {
+    t.Error("Unexpected result of applying the second hunk", got)
+  }
+  if got := ApplyHunks(a, nil); string(JoinLines(got)) != string(JoinLines(a)) {
+    t.Error("Applying no hunks should keep the text")
+  }
+  // A hunk with one run of changes isn't split.
+  if subs := SplitHunk(subs[0], 3); len(subs) != 1 {
+    t.Error("Expecting the hunk not split")
+  }
+
+  // Randomly applying any subset of the hunks changes exactly those lines.
+  r := rand.New(rand.NewSource(1))
+  for round := 0; round < 200; round++ {
+    a, b := make([]string, 30), make([]string, 30)
+    for i := range(a) {
+      a[i] = string('a' + rune(r.Intn(3))) + "\n"
+      b[i] = a[i]
+      if r.Intn(5) == 0 {
+        b[i] = "changed\n"
+      }
+    }
+    hunks := make([]Hunk, 0)
+    for _, hunk := range(GetHunks(DiffLines(a, b), 3)) {
+      hunks = append(hunks, SplitHunk(hunk, 1)...)
+    }
+    if got := JoinLines(ApplyHunks(a, hunks)); string(got) != string(JoinLines(b)) {
+      t.Fatal("Applying all hunks should give the new text")
+    }
+  }
+}
+
+func TestParseHunk(t *testing.T) {
+  a := linesOf("1\n2\n3\n4")
+  b := linesOf("1\n2x\n3\n4\nnew")
+  hunks := GetHunks(DiffLines(a, b), 3)
+  if len(hunks) != 1 {
+    t.Fatal("Expecting one hunk, got", len(hunks))
+  }
+  // Keeps the deletion of line 2 as context and drops the insertion of 2x.
+  body := "@@ -1,4 +1,5 @@\n 1\n 2\n 3\n-4\n\\ No newline at end of file\n+4\n+new\n" +
+          "\\ No newline at end of file\n"
+  hunk, err := ParseHunk(body, a, hunks[0])
+  if err != nil {
+    t.Fatal("Failed to parse the hunk:", err)
+  }
+  if got := string(JoinLines(ApplyHunks(a, []Hunk{hunk}))); got != "1\n2\n3\n4\nnew" {
+    t.Errorf("Unexpected result of the edited hunk %q", got)
+  }
+  if _, err := ParseHunk(" 1\n-3\n", a, hunks[0]); err != ErrHunkNotApply {
+    t.Error("Expecting ErrHunkNotApply for mismatched lines")
+  }
+  if _, err := ParseHunk(" 1\nbad\n", a, hunks[0]); err != ErrHunkNotApply {
+    t.Error("Expecting ErrHunkNotApply for lines without prefix")
+  }
+}
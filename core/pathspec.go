@@ -0,0 +1,187 @@
+package core
+
+import (
+  "errors"
+  "path"
+  "sort"
+  "strings"
+)
+
+var ErrInvalidPathspec = errors.New("core: invalid pathspec")
+
+// Pathspec selects paths in trees. It's a list of patterns, each of them can be:
+//
+//   <path>              the file, or everything under the directory
+//   <glob>              paths matching the glob, "*", "?" and "[...]" don't match "/",
+//                       "**" matches any number of directories; a directory matching
+//                       the glob selects everything under it
+//   :(exclude)<pattern> paths matching the pattern are left out, also :!<pattern> and
+//                       :^<pattern>
+//   :/<pattern>         the pattern is relative to the root of the repository
+//
+// Patterns are relative to the prefix, i.e. the current directory in the repository.
+// A pathspec with only exclude patterns selects everything under the prefix except them.
+type Pathspec struct {
+  items []pathspecItem
+}
+
+type pathspecItem struct {
+  // The original pattern given by users.
+  original string
+  // The tree path of the pattern.
+  pattern string
+  exclude bool
+  glob bool
+}
+
+// Parses the patterns, relative to the prefix which is a tree path.
+func ParsePathspec(patterns []string, prefix string) (*Pathspec, error) {
+  ps := &Pathspec{}
+  hasInclude := false
+  for _, original := range(patterns) {
+    item := pathspecItem{original : original}
+    p := original
+    switch {
+    case strings.HasPrefix(p, ":(exclude)"):
+      item.exclude, p = true, p[len(":(exclude)"):]
+    case strings.HasPrefix(p, ":!"), strings.HasPrefix(p, ":^"):
+      item.exclude, p = true, p[2:]
+    }
+    base := prefix
+    if strings.HasPrefix(p, ":/") {
+      base, p = "/", p[2:]
+    } else if strings.HasPrefix(p, ":") {
+      return nil, ErrInvalidPathspec
+    }
+    item.pattern = path.Join("/", base, p)
+    if rel := path.Join(strings.TrimPrefix(base, "/"), p); rel == ".." ||
+       strings.HasPrefix(rel, "../") {
+      // The pattern is outside of the repository.
+      return nil, ErrInvalidPathspec
+    }
+    item.glob = strings.ContainsAny(p, "*?[")
+    if !item.exclude {
+      hasInclude = true
+    }
+    ps.items = append(ps.items, item)
+  }
+  if !hasInclude {
+    ps.items = append(ps.items, pathspecItem{original : ".", pattern : path.Join("/", prefix)})
+  }
+  return ps, nil
+}
+
+// Checks whether the path is selected by the pathspec.
+func (ps *Pathspec) Match(treePath string) bool {
+  matched := false
+  for _, item := range(ps.items) {
+    if item.match(treePath) {
+      if item.exclude {
+        return false
+      }
+      matched = true
+    }
+  }
+  return matched
+}
+
+// Checks whether the directory or any path under it may be selected by the pathspec,
+// it's used to decide whether to look into the directory.
+func (ps *Pathspec) MayMatchUnder(dir string) bool {
+  if ps.Match(dir) {
+    return true
+  }
+  for _, item := range(ps.items) {
+    if item.exclude {
+      continue
+    }
+    // The leading part of the pattern without wildcards.
+    literal := item.pattern
+    if item.glob {
+      literal = literal[:strings.IndexAny(literal, "*?[")]
+      if idx := strings.LastIndex(literal, "/"); idx != -1 {
+        literal = literal[:idx]
+      }
+    }
+    if dir == "/" || literal == dir || strings.HasPrefix(literal, dir + "/") ||
+       (item.glob && strings.HasPrefix(dir, literal + "/")) {
+      return true
+    }
+  }
+  return false
+}
+
+// Checks whether the path of the tree is selected by the pathspec. A directory is selected
+// if any file under it is, MayMatchUnder alone isn't enough as it only looks at the
+// leading part of globs.
+func (ps *Pathspec) MatchTree(tree Tree, treePath string) bool {
+  node, err := tree.Get(treePath)
+  if err != nil || !node.IsDir() {
+    return ps.Match(treePath)
+  }
+  found := false
+  tree.Traverse(func(p string, node Node) error {
+    if found || (node.IsDir() && !ps.MayMatchUnder(p)) {
+      return SkipDirNode
+    }
+    found = !node.IsDir() && ps.Match(p)
+    return nil
+  }, treePath)
+  return found
+}
+
+// Gets the paths of the files in the tree which are selected by the pathspec, the paths
+// are sorted.
+func (ps *Pathspec) MatchFiles(tree Tree) []string {
+  files := make([]string, 0)
+  tree.Traverse(func(treePath string, node Node) error {
+    if node.IsDir() {
+      if !ps.MayMatchUnder(treePath) {
+        return SkipDirNode
+      }
+    } else if ps.Match(treePath) {
+      files = append(files, treePath)
+    }
+    return nil
+  }, "/")
+  sort.Strings(files)
+  return files
+}
+
+// Gets the patterns which don't select any of the paths, exclude patterns are not
+// included. It's used to report patterns which match nothing.
+func (ps *Pathspec) Unmatched(paths []string) []string {
+  unmatched := make([]string, 0)
+  for _, item := range(ps.items) {
+    if item.exclude {
+      continue
+    }
+    found := false
+    for _, p := range(paths) {
+      if item.match(p) {
+        found = true
+        break
+      }
+    }
+    if !found {
+      unmatched = append(unmatched, item.original)
+    }
+  }
+  return unmatched
+}
+
+// Checks whether the path or any of its parent directories matches the pattern.
+func (item pathspecItem) match(treePath string) bool {
+  if item.pattern == "/" {
+    return true
+  }
+  if !item.glob {
+    return treePath == item.pattern || strings.HasPrefix(treePath, item.pattern + "/")
+  }
+  for p := treePath; p != "/"; p = path.Dir(p) {
+    if MatchGlob(item.pattern[1:], p[1:]) {
+      return true
+    }
+  }
+  return false
+}
@@ -0,0 +1,107 @@
+package core
+
+import (
+  "reflect"
+  "testing"
+)
+
+func TestPathspecMatch(t *testing.T) {
+  ps, err := ParsePathspec([]string{"src", "*.md", "lib/**/*.c", ":(exclude)src/gen",
+                                    ":!**/*.o", ":/top"}, "/sub")
+  if err != nil {
+    t.Fatal(err)
+  }
+  expected := map[string]bool {
+    "/sub/src" : true,
+    "/sub/src/a.c" : true,
+    "/sub/src/gen/x.c" : false,
+    "/sub/src/a.o" : false,
+    "/sub/srcx" : false,
+    "/sub/README.md" : true,
+    "/sub/doc/README.md" : false,
+    "/README.md" : false,
+    "/sub/lib/a.c" : true,
+    "/sub/lib/x/y/a.c" : true,
+    "/sub/lib/x/y/a.h" : false,
+    "/top/a" : true,
+    "/sub/top" : false,
+  }
+  for treePath, result := range(expected) {
+    if ps.Match(treePath) != result {
+      t.Errorf("Expecting Match(%s) to be %v", treePath, result)
+    }
+  }
+  for _, dir := range([]string{"/", "/sub", "/sub/lib", "/sub/lib/x", "/top"}) {
+    if !ps.MayMatchUnder(dir) {
+      t.Errorf("Expecting MayMatchUnder(%s)", dir)
+    }
+  }
+  if ps.MayMatchUnder("/other") {
+    t.Error("Expecting nothing to match under /other")
+  }
+  unmatched := ps.Unmatched([]string{"/sub/src/a.c", "/sub/lib/a.c"})
+  if !reflect.DeepEqual(unmatched, []string{"*.md", ":/top"}) {
+    t.Errorf("Unexpected unmatched patterns %v", unmatched)
+  }
+}
+
+func TestPathspecExcludeOnly(t *testing.T) {
+  ps, err := ParsePathspec([]string{":(exclude)*.o"}, "/")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if !ps.Match("/a.c") || ps.Match("/a.o") || !ps.Match("/dir/b.c") {
+    t.Error("Unexpected result of exclude only pathspec")
+  }
+  if _, err := ParsePathspec([]string{"../x"}, "/"); err != ErrInvalidPathspec {
+    t.Errorf("Expecting ErrInvalidPathspec, got %v", err)
+  }
+  if _, err := ParsePathspec([]string{"../x"}, "/sub"); err != nil {
+    t.Errorf("Expecting ../x to be valid in /sub, got %v", err)
+  }
+}
+
+func TestPathspecMatchFiles(t *testing.T) {
+  tree := NewMemTree()
+  for _, p := range([]string{"/a.c", "/dir/b.c", "/dir/c.h", "/other/d.c"}) {
+    hash, _, _ := WrapData(BlobType, []byte(p))
+    tree.MkFileAll(p, hash[:])
+  }
+  ps, _ := ParsePathspec([]string{"dir", "*.c"}, "/")
+  files := ps.MatchFiles(tree)
+  if !reflect.DeepEqual(files, []string{"/a.c", "/dir/b.c", "/dir/c.h"}) {
+    t.Errorf("Unexpected files %v", files)
+  }
+}
+
+func TestPathspecMatchTree(t *testing.T) {
+  tree := NewMemTree()
+  for _, p := range([]string{"/README.md", "/src/main.go", "/doc/guide.md", "/lib/x/a.c"}) {
+    hash, _, _ := WrapData(BlobType, []byte(p))
+    tree.MkFileAll(p, hash[:])
+  }
+  tree.MkDirAll("/empty")
+  ps, _ := ParsePathspec([]string{"*.md"}, "/")
+  // The literal prefix of "*.md" is empty, so MayMatchUnder is true for any path.
+  if !ps.MayMatchUnder("/src/main.go") {
+    t.Error("Expecting MayMatchUnder(/src/main.go)")
+  }
+  expected := map[string]bool {
+    "/README.md" : true,
+    "/src/main.go" : false,
+    "/src" : false,
+    "/doc" : false,
+    "/empty" : false,
+    "/" : true,
+    "/missing.md" : true,
+  }
+  for treePath, result := range(expected) {
+    if ps.MatchTree(tree, treePath) != result {
+      t.Errorf("Expecting MatchTree(%s) to be %v", treePath, result)
+    }
+  }
+  ps, _ = ParsePathspec([]string{"lib/**/*.c"}, "/")
+  if !ps.MatchTree(tree, "/lib") || !ps.MatchTree(tree, "/lib/x") || ps.MatchTree(tree, "/src") {
+    t.Error("Unexpected result of MatchTree for lib/**/*.c")
+  }
+}
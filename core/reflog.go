@@ -0,0 +1,160 @@
+package core
+
+import (
+  "bufio"
+  "bytes"
+  "encoding/hex"
+  "fmt"
+  "os"
+  "path/filepath"
+  "strings"
+  "time"
+)
+
+// The hash recorded as the old value when a ref is created.
+var zeroHash = make([]byte, HashSize)
+
+// A single entry of reflog, which records an update of a ref.
+type ReflogEntry struct {
+  Old []byte
+  New []byte
+  Who Signature
+  Reason string
+}
+
+// Appends an entry to the reflog of the ref, refPath is relative to .flea directory
+// (e.g. HEAD or refs/heads/master). The logs are stored in .flea/logs/<refPath>.
+func AppendReflog(refPath string, oldHash, newHash []byte, reason string) error {
+  who, err := GetCommitterIdent()
+  if err != nil {
+    who.When = time.Now()
+  }
+  line := formatReflogLine(ReflogEntry{oldHash, newHash, who, reason})
+  logPath := getReflogPath(refPath)
+  if err := os.MkdirAll(filepath.Dir(logPath), 0777); err != nil {
+    return err
+  }
+  file, err := os.OpenFile(logPath, os.O_APPEND | os.O_CREATE | os.O_WRONLY, 0666)
+  if err != nil {
+    return err
+  }
+  defer file.Close()
+  _, err = file.WriteString(line)
+  return err
+}
+
+// Reads the reflog of the ref, the newest entry comes first. A ref without reflog has
+// no entries.
+func ReadReflog(refPath string) ([]ReflogEntry, error) {
+  entries := make([]ReflogEntry, 0)
+  data, err := read(getReflogPath(refPath))
+  if err == ErrFileNotExist {
+    return entries, nil
+  }
+  scanner := bufio.NewScanner(bytes.NewReader(data))
+  for scanner.Scan() {
+    entry, err := parseReflogLine(scanner.Text())
+    if err != nil {
+      return nil, err
+    }
+    entries = append(entries, entry)
+  }
+  // Reverses the entries so the newest one comes first.
+  for i, j := 0, len(entries) - 1; i < j; i, j = i + 1, j - 1 {
+    entries[i], entries[j] = entries[j], entries[i]
+  }
+  return entries, scanner.Err()
+}
+
+// Deletes the Nth entry of the reflog, counting from the newest one.
+func DeleteReflogEntry(refPath string, n int) error {
+  entries, err := ReadReflog(refPath)
+  if err != nil {
+    return err
+  }
+  if n < 0 || n >= len(entries) {
+    return ErrNoReflog
+  }
+  entries = append(entries[:n], entries[n + 1:]...)
+  var buf bytes.Buffer
+  for i := len(entries) - 1; i >= 0; i-- {
+    buf.WriteString(formatReflogLine(entries[i]))
+  }
+  return write(getReflogPath(refPath), buf.Bytes())
+}
+
+// Formats the entry to "<old> <new> <name> <<email>> <unix-seconds> <zone>\t<reason>\n".
+func formatReflogLine(entry ReflogEntry) string {
+  old := entry.Old
+  if old == nil {
+    old = zeroHash
+  }
+  // Reasons are kept on a single line.
+  reason := strings.Replace(strings.TrimSpace(entry.Reason), "\n", " ", -1)
+  return fmt.Sprintf("%x %x %s %d %s\t%s\n", old, entry.New, entry.Who, entry.Who.When.Unix(),
+                     entry.Who.When.Format("-0700"), reason)
+}
+
+// Gets the path of the ref for the given name, it can be HEAD, a branch, or a full ref
+// path like refs/heads/master.
+func GetRefPath(name string) (string, error) {
+  if name == "HEAD" || name == "@" {
+    return "HEAD", nil
+  }
+  refPath, _, err := resolveRefName(name)
+  return refPath, err
+}
+
+// Parses "<old> <new> <name> <<email>> <unix-seconds> <zone>\t<reason>".
+func parseReflogLine(line string) (ReflogEntry, error) {
+  var entry ReflogEntry
+  tab := strings.Index(line, "\t")
+  if tab == -1 || tab < 4 * HashSize + 2 {
+    return entry, ErrFileCorrupted
+  }
+  entry.Reason = line[tab + 1:]
+  header := line[:tab]
+  var err error
+  if entry.Old, err = hex.DecodeString(header[:2 * HashSize]); err != nil {
+    return entry, ErrFileCorrupted
+  }
+  if entry.New, err = hex.DecodeString(header[2 * HashSize + 1:4 * HashSize + 1]); err != nil {
+    return entry, ErrFileCorrupted
+  }
+  ident := header[4 * HashSize + 2:]
+  gt := strings.LastIndex(ident, ">")
+  if gt == -1 {
+    return entry, ErrFileCorrupted
+  }
+  if entry.Who, err = ParseIdent(ident[:gt + 1]); err != nil {
+    return entry, ErrFileCorrupted
+  }
+  if entry.Who.When, err = ParseDate(ident[gt + 1:]); err != nil {
+    return entry, ErrFileCorrupted
+  }
+  if bytes.Compare(entry.Old, zeroHash) == 0 {
+    entry.Old = nil
+  }
+  return entry, nil
+}
+
+// Gets the Nth prior value of the ref, @{0} is the current value.
+func resolveReflogEntry(refPath string, n int) ([]byte, error) {
+  entries, err := ReadReflog(refPath)
+  if err != nil {
+    return nil, err
+  }
+  if n == 0 && len(entries) == 0 {
+    // The ref was created before reflog was recorded.
+    _, hash, err := resolveRefName(refPath)
+    return hash, err
+  }
+  if n >= len(entries) {
+    return nil, ErrNoReflog
+  }
+  return entries[n].New, nil
+}
+
+func getReflogPath(refPath string) string {
+  return filepath.Join(GetFleaDirectory(), "logs", filepath.FromSlash(refPath))
+}
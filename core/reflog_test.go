@@ -0,0 +1,56 @@
+package core
+
+import (
+  "bytes"
+  "encoding/hex"
+  "testing"
+)
+
+func TestReflog(t *testing.T) {
+  if _, err := initTestRepo("reflog_test"); err != nil {
+    t.Fatal(err)
+  }
+  c1, _ := commitTestFiles(map[string][]byte{"/a" : []byte("a1")}, "c1")
+  c2, _ := commitTestFiles(map[string][]byte{"/a" : []byte("a2")}, "c2")
+  // Detaches HEAD to the first commit.
+  WriteHeadFile([]byte(hex.EncodeToString(c1)), "checkout: moving from master to c1")
+
+  entries, err := ReadReflog("HEAD")
+  if err != nil || len(entries) != 3 {
+    t.Fatal("Expecting 3 entries in reflog of HEAD", err)
+  }
+  if entries[0].Reason != "checkout: moving from master to c1" {
+    t.Error("Incorrect reason:", entries[0].Reason)
+  }
+  if bytes.Compare(entries[0].Old, c2) != 0 || bytes.Compare(entries[0].New, c1) != 0 {
+    t.Error("Incorrect old/new hash of the newest entry")
+  }
+  if entries[2].Old != nil {
+    t.Error("The first update should have no old hash")
+  }
+  if entries[0].Who.Name == "" || entries[0].Who.When.IsZero() {
+    t.Error("Identity of the entry is not recorded")
+  }
+  if entries, _ := ReadReflog("refs/heads/master"); len(entries) != 2 {
+    t.Error("Expecting 2 entries in reflog of master")
+  }
+
+  expected := map[string][]byte {
+    "HEAD@{0}" : c1,
+    "HEAD@{1}" : c2,
+    "HEAD@{2}" : c1,
+    "master@{0}" : c2,
+    "master@{1}" : c1,
+    // HEAD is detached so @{N} refers to the reflog of HEAD.
+    "@{1}" : c2,
+    "master@{0}~1" : c1,
+  }
+  for rev, hash := range(expected) {
+    if h, err := ResolveRevision(rev); err != nil || bytes.Compare(h, hash) != 0 {
+      t.Errorf("Failed to resolve %s: %v", rev, err)
+    }
+  }
+  if _, err := ResolveRevision("master@{2}"); err != ErrNoReflog {
+    t.Error("Expecting ErrNoReflog")
+  }
+}
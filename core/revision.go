@@ -0,0 +1,387 @@
+package core
+
+import (
+  "encoding/hex"
+  "errors"
+  "fmt"
+  "os"
+  "path"
+  "path/filepath"
+  "strconv"
+  "strings"
+)
+
+var (
+  ErrUnknownRevision = errors.New("core: unknown revision")
+  ErrInvalidRevision = errors.New("core: invalid revision syntax")
+  ErrNoParent = errors.New("core: revision has no such parent")
+  ErrNotCommit = errors.New("core: revision doesn't point to a commit")
+  ErrNoReflog = errors.New("core: no such reflog entry")
+)
+
+// The minimum length of an abbreviated hash.
+const MinAbbrevLength = 4
+
+// AmbiguousRevisionError is returned when a revision matches more than one object or ref.
+type AmbiguousRevisionError struct {
+  Rev string
+  Candidates []string
+}
+
+func (e *AmbiguousRevisionError) Error() string {
+  return fmt.Sprintf("core: ambiguous revision '%s', candidates are:\n  %s", e.Rev,
+                     strings.Join(e.Candidates, "\n  "))
+}
+
+// Resolves a revision expression to the hash of an object. The expression can be:
+//
+//   HEAD, @             the commit HEAD points to
+//   <branch>, <tag>     also in full form heads/<branch>, refs/tags/<tag> etc.
+//                       a tag is ambiguous with a branch of the same name
+//   <hash>              full or abbreviated hash of any object
+//   <ref>@{N}, @{N}     the Nth prior value of the ref, @{N} is of current branch
+//   <rev>~N             the Nth generation ancestor, ~ equals to ~1
+//   <rev>^N             the Nth parent, ^ equals to ^1 and ^0 is the commit itself
+//   <rev>:<path>        the blob or tree at <path> in the tree of <rev>
+//   :<path>             the blob or tree at <path> in the index
+//
+// The path is relative to the root of the repository, unless it starts with ./ or ../.
+func ResolveRevision(rev string) ([]byte, error) {
+  if colon := strings.Index(rev, ":"); colon != -1 {
+    return resolveRevisionPath(rev[:colon], rev[colon + 1:])
+  }
+  base := rev
+  // The name of refs can't contain ~ or ^, everything after them are suffixes.
+  if idx := strings.IndexAny(rev, "~^"); idx != -1 {
+    base = rev[:idx]
+  }
+  hash, err := resolveRevisionBase(base)
+  if err != nil {
+    return nil, err
+  }
+  suffixes := rev[len(base):]
+  for len(suffixes) > 0 {
+    op := suffixes[0]
+    end := 1
+    for end < len(suffixes) && suffixes[end] >= '0' && suffixes[end] <= '9' {
+      end++
+    }
+    n := 1
+    if end > 1 {
+      if n, err = strconv.Atoi(suffixes[1:end]); err != nil {
+        return nil, ErrInvalidRevision
+      }
+    }
+    suffixes = suffixes[end:]
+    if op != '~' && op != '^' {
+      return nil, ErrInvalidRevision
+    }
+    if hash, err = PeelToCommit(hash); err != nil {
+      return nil, err
+    }
+    if op == '^' && n > 1 {
+      // Commits have at most one parent.
+      return nil, ErrNoParent
+    }
+    for i := 0; i < n; i++ {
+      commit, err := GetCommitObject(hash)
+      if err != nil {
+        return nil, err
+      }
+      if commit.PrevCommit == nil {
+        return nil, ErrNoParent
+      }
+      hash = commit.PrevCommit
+    }
+  }
+  return hash, nil
+}
+
+// Resolves the revision to a commit, see ResolveRevision for the syntax.
+func ResolveCommit(rev string) (*Commit, []byte, error) {
+  hash, err := ResolveRevision(rev)
+  if err != nil {
+    return nil, nil, err
+  }
+  if hash, err = PeelToCommit(hash); err != nil {
+    return nil, nil, err
+  }
+  commit, err := GetCommitObject(hash)
+  return commit, hash, err
+}
+
+// Peels the object to the commit it refers to, following tag objects. Returns
+// ErrNotCommit if the object doesn't end up in a commit.
+func PeelToCommit(hash []byte) ([]byte, error) {
+  hash, fType, err := PeelTag(hash)
+  if err != nil {
+    return nil, err
+  }
+  if fType != CommitType {
+    return nil, ErrNotCommit
+  }
+  return hash, nil
+}
+
+// Resolves the part of the revision before any suffix.
+func resolveRevisionBase(base string) ([]byte, error) {
+  if at := strings.Index(base, "@{"); at != -1 && strings.HasSuffix(base, "}") {
+    n, err := strconv.Atoi(base[at + 2:len(base) - 1])
+    if err != nil || n < 0 {
+      return nil, ErrInvalidRevision
+    }
+    ref := base[:at]
+    if ref == "" {
+      // @{N} refers to the reflog of current branch, or HEAD if it's detached.
+      if branch, err := GetCurrentBranch(); err == nil {
+        ref = branch
+      } else {
+        ref = "HEAD"
+      }
+    }
+    refPath, _, err := resolveRefName(ref)
+    if err != nil {
+      return nil, err
+    }
+    return resolveReflogEntry(refPath, n)
+  }
+  if base == "" {
+    return nil, ErrInvalidRevision
+  }
+  if refPath, hash, err := resolveRefName(base); err == nil {
+    return hash, nil
+  } else if err != ErrUnknownRevision || refPath != "" {
+    return nil, err
+  }
+  return resolveHashPrefix(base)
+}
+
+// Resolves the name of a ref. It returns the path of the ref relative to .flea directory
+// (e.g. refs/heads/master) and the hash it points to.
+func resolveRefName(name string) (string, []byte, error) {
+  if name == "HEAD" || name == "@" {
+    hash, err := GetHeadHash()
+    if err == ErrNoHeadFile {
+      return "HEAD", nil, ErrUnknownRevision
+    }
+    return "HEAD", hash, err
+  }
+  candidates := []string{name, "refs/" + name, "refs/tags/" + name, "refs/heads/" + name}
+  if strings.HasPrefix(name, "refs/") {
+    candidates = candidates[:1]
+  }
+  matched := make([]string, 0, 1)
+  var hash []byte
+  for _, refPath := range(candidates) {
+    if refPath == "HEAD" || !isValidRefPath(refPath) {
+      continue
+    }
+    if h, err := readRef(refPath); err == nil {
+      matched = append(matched, refPath)
+      hash = h
+    }
+  }
+  if len(matched) > 1 {
+    return "", nil, &AmbiguousRevisionError{name, matched}
+  }
+  if len(matched) == 0 {
+    return "", nil, ErrUnknownRevision
+  }
+  return matched[0], hash, nil
+}
+
+// Resolves an abbreviated hash.
+func resolveHashPrefix(prefix string) ([]byte, error) {
+  if len(prefix) < MinAbbrevLength || len(prefix) > 2 * HashSize {
+    return nil, ErrUnknownRevision
+  }
+  if _, err := hex.DecodeString(prefix + strings.Repeat("0", len(prefix) % 2)); err != nil {
+    return nil, ErrUnknownRevision
+  }
+  store := GetCAStore()
+  hashs := store.GetMatchedHashsByString(prefix)
+  if len(hashs) == 0 {
+    return nil, ErrUnknownRevision
+  }
+  if len(hashs) > 1 {
+    candidates := make([]string, len(hashs))
+    for i, hash := range(hashs) {
+      fType, _, _ := store.Get(hash)
+      candidates[i] = fmt.Sprintf("%x %s", hash, fType)
+    }
+    return nil, &AmbiguousRevisionError{prefix, candidates}
+  }
+  return hashs[0], nil
+}
+
+// Resolves <rev>:<path>, or :<path> for the index.
+func resolveRevisionPath(rev, treePath string) ([]byte, error) {
+  if strings.HasPrefix(treePath, "./") || strings.HasPrefix(treePath, "../") ||
+     treePath == "." || treePath == ".." {
+    treePath = path.Join(GetPathPrefix(), treePath)
+  } else {
+    treePath = path.Join("/", treePath)
+  }
+  var tree Tree
+  if rev == "" {
+    tree = GetIndexTree()
+  } else {
+    commit, _, err := ResolveCommit(rev)
+    if err != nil {
+      return nil, err
+    }
+    tree = commit.GetCATree()
+  }
+  node, err := tree.Get(treePath)
+  if err != nil {
+    return nil, err
+  }
+  return node.GetHashValue(), nil
+}
+
+// Reads the hash stored in the ref file, the path is relative to .flea directory.
+func readRef(refPath string) ([]byte, error) {
+  fullPath := filepath.Join(GetFleaDirectory(), filepath.FromSlash(refPath))
+  if fi, err := os.Stat(fullPath); err != nil || !fi.Mode().IsRegular() {
+    return nil, ErrFileNotExist
+  }
+  data, err := read(fullPath)
+  if err != nil {
+    return nil, err
+  }
+  hash, err := hex.DecodeString(strings.TrimSpace(string(data)))
+  if err != nil || len(hash) != HashSize {
+    return nil, ErrNotValidHash
+  }
+  return hash, nil
+}
+
+// Checks that a ref path doesn't escape the refs directory.
+func isValidRefPath(refPath string) bool {
+  if refPath == "" || strings.HasSuffix(refPath, "/") || strings.Contains(refPath, "..") {
+    return false
+  }
+  return refPath == "HEAD" || strings.HasPrefix(refPath, "refs/")
+}
+
+// Checks whether the revision is a range in the form of <rev1>..<rev2>.
+func IsRevisionRange(rev string) bool {
+  return strings.Contains(rev, "..") && !strings.Contains(rev, ":")
+}
+
+// Resolves a range of commits in the form of <rev1>..<rev2>, i.e. the commits reachable
+// from <rev2> but not from <rev1>. Either side can be omitted, which means HEAD. The
+// hashes are returned newest first.
+func ResolveRevisionRange(rev string) ([][]byte, error) {
+  idx := strings.Index(rev, "..")
+  if idx == -1 {
+    return nil, ErrInvalidRevision
+  }
+  from, to := rev[:idx], rev[idx + 2:]
+  if from == "" {
+    from = "HEAD"
+  }
+  if to == "" {
+    to = "HEAD"
+  }
+  _, fromHash, err := ResolveCommit(from)
+  if err != nil {
+    return nil, err
+  }
+  _, toHash, err := ResolveCommit(to)
+  if err != nil {
+    return nil, err
+  }
+  return ListCommits(fromHash, toHash)
+}
+
+// Gets the commits reachable from include but not from exclude, newest first. All the
+// ancestors of include are returned if exclude is nil.
+func ListCommits(exclude, include []byte) ([][]byte, error) {
+  excluded := make(map[string]bool)
+  for hash := exclude; hash != nil; {
+    excluded[string(hash)] = true
+    commit, err := GetCommitObject(hash)
+    if err != nil {
+      return nil, err
+    }
+    hash = commit.PrevCommit
+  }
+  hashs := make([][]byte, 0)
+  for hash := include; hash != nil && !excluded[string(hash)]; {
+    hashs = append(hashs, hash)
+    commit, err := GetCommitObject(hash)
+    if err != nil {
+      return nil, err
+    }
+    hash = commit.PrevCommit
+  }
+  return hashs, nil
+}
+
+// Gets the commits reachable from any of include but not from any of exclude. The
+// commits are ordered newest first by committer date, but a commit always comes before
+// its parent.
+func WalkCommits(include, exclude [][]byte) ([][]byte, error) {
+  excluded := make(map[string]bool)
+  for _, hash := range(exclude) {
+    for ; hash != nil && !excluded[string(hash)]; {
+      excluded[string(hash)] = true
+      commit, err := GetCommitObject(hash)
+      if err != nil {
+        return nil, err
+      }
+      hash = commit.PrevCommit
+    }
+  }
+  commits := make(map[string]*Commit)
+  // The number of children of each commit which haven't been returned yet.
+  children := make(map[string]int)
+  ready := make([][]byte, 0)
+  for _, hash := range(include) {
+    if excluded[string(hash)] || commits[string(hash)] != nil {
+      continue
+    }
+    ready = append(ready, hash)
+    for ; hash != nil && !excluded[string(hash)] && commits[string(hash)] == nil; {
+      commit, err := GetCommitObject(hash)
+      if err != nil {
+        return nil, err
+      }
+      commits[string(hash)] = commit
+      hash = commit.PrevCommit
+      if hash != nil {
+        children[string(hash)]++
+      }
+    }
+  }
+  // Commits which are included by another one are not ready until their children are.
+  pending := ready
+  ready = make([][]byte, 0, len(pending))
+  for _, hash := range(pending) {
+    if children[string(hash)] == 0 {
+      ready = append(ready, hash)
+    }
+  }
+  hashs := make([][]byte, 0, len(commits))
+  for len(ready) > 0 {
+    newest := 0
+    for i := 1; i < len(ready); i++ {
+      if commits[string(ready[i])].GetCommitter().When.After(
+           commits[string(ready[newest])].GetCommitter().When) {
+        newest = i
+      }
+    }
+    hash := ready[newest]
+    ready = append(ready[:newest], ready[newest + 1:]...)
+    hashs = append(hashs, hash)
+    parent := commits[string(hash)].PrevCommit
+    if parent == nil || commits[string(parent)] == nil {
+      continue
+    }
+    if children[string(parent)]--; children[string(parent)] == 0 {
+      ready = append(ready, parent)
+    }
+  }
+  return hashs, nil
+}
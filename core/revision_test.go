@@ -0,0 +1,109 @@
+package core
+
+import (
+  "bytes"
+  "encoding/hex"
+  "io/ioutil"
+  "path/filepath"
+  "strings"
+  "testing"
+  "time"
+)
+
+func TestResolveRevision(t *testing.T) {
+  if _, err := initTestRepo("revision_test"); err != nil {
+    t.Fatal(err)
+  }
+  c1, _ := commitTestFiles(map[string][]byte{"/a" : []byte("a1")}, "c1")
+  c2, _ := commitTestFiles(map[string][]byte{"/dir/b" : []byte("b1")}, "c2")
+  c3, _ := commitTestFiles(map[string][]byte{"/a" : []byte("a3")}, "c3")
+  blobA1, _, _ := WrapData(BlobType, []byte("a1"))
+
+  expected := map[string][]byte {
+    "HEAD" : c3,
+    "@" : c3,
+    "master" : c3,
+    "heads/master" : c3,
+    "refs/heads/master" : c3,
+    "HEAD~" : c2,
+    "HEAD~2" : c1,
+    "master^" : c2,
+    "master^^" : c1,
+    "HEAD~1^" : c1,
+    "HEAD^0" : c3,
+    "@{0}" : c3,
+    "HEAD~2:a" : blobA1[:],
+    ":/dir/b" : GetIndexTree().memTree.root.Children["dir"].Children["b"].GetHashValue(),
+  }
+  for rev, hash := range(expected) {
+    if h, err := ResolveRevision(rev); err != nil || bytes.Compare(h, hash) != 0 {
+      t.Errorf("Failed to resolve %s: %v", rev, err)
+    }
+  }
+  abbrev := hex.EncodeToString(c2)[:7]
+  if h, err := ResolveRevision(abbrev + "~"); err != nil || bytes.Compare(h, c1) != 0 {
+    t.Errorf("Failed to resolve abbreviated hash: %v", err)
+  }
+
+  errors := map[string]error {
+    "HEAD~3" : ErrNoParent,
+    "HEAD^2" : ErrNoParent,
+    "nosuchbranch" : ErrUnknownRevision,
+    "HEAD:nosuchfile" : ErrPathNotExist,
+    "HEAD~x" : ErrInvalidRevision,
+  }
+  for rev, expectedErr := range(errors) {
+    if _, err := ResolveRevision(rev); err != expectedErr {
+      t.Errorf("Expecting %v for %s, got %v", expectedErr, rev, err)
+    }
+  }
+
+  // Two objects whose hashes share the same prefix.
+  storeDir := GetStoreDirectory()
+  for _, name := range([]string{"abcd" + strings.Repeat("0", 36), "abcd" + strings.Repeat("1", 36)}) {
+    ioutil.WriteFile(filepath.Join(storeDir, name), []byte("blob 0\x00"), 0666)
+  }
+  if _, err := ResolveRevision("abcd"); err == nil {
+    t.Error("Expecting ambiguous revision")
+  } else if e, ok := err.(*AmbiguousRevisionError); !ok || len(e.Candidates) != 2 {
+    t.Errorf("Expecting AmbiguousRevisionError, got %v", err)
+  }
+  if _, err := ResolveRevision("abcd0"); err != nil {
+    t.Errorf("Failed to resolve unambiguous prefix: %v", err)
+  }
+}
+
+func TestWalkCommits(t *testing.T) {
+  if _, err := initTestRepo("walk_commits_test"); err != nil {
+    t.Fatal(err)
+  }
+  c1, _ := commitTestFiles(map[string][]byte{"/a" : []byte("a1")}, "c1")
+  c2, _ := commitTestFiles(map[string][]byte{"/a" : []byte("a2")}, "c2")
+  // c3 forks from c1 and is newer than c2.
+  commit, _ := GetCommitObject(c2)
+  sig := Signature{"Tester", "tester@example.com", time.Unix(1600000000, 0)}
+  c3, _ := CreateCommitObject(commit.Tree, c1, sig, sig, "c3")
+  sig.When = time.Unix(1700000000, 0)
+  c4, _ := CreateCommitObject(commit.Tree, c2, sig, sig, "c4")
+
+  check := func(include, exclude [][]byte, expected ...[]byte) {
+    hashs, err := WalkCommits(include, exclude)
+    if err != nil {
+      t.Fatal(err)
+    }
+    if len(hashs) != len(expected) {
+      t.Fatalf("Expecting %d commits, got %d", len(expected), len(hashs))
+    }
+    for i, hash := range(hashs) {
+      if !bytes.Equal(hash, expected[i]) {
+        t.Errorf("Unexpected commit at %d", i)
+      }
+    }
+  }
+  check([][]byte{c4}, nil, c4, c2, c1)
+  check([][]byte{c2, c3}, nil, c3, c2, c1)
+  // c2 is also reachable from c4, it comes only once and after c4.
+  check([][]byte{c3, c2, c4}, nil, c4, c3, c2, c1)
+  check([][]byte{c4, c3}, [][]byte{c2}, c4, c3)
+  check([][]byte{c2}, [][]byte{c4})
+}
@@ -0,0 +1,143 @@
+package core
+
+import (
+  "bytes"
+  "encoding/hex"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "strings"
+)
+
+var (
+  ErrNoSequencer = errors.New("core: no sequencer in progress")
+  ErrInvalidTodo = errors.New("core: invalid todo list")
+)
+
+// The directory in .flea which keeps the state of the sequencer.
+const SequencerDir = "sequencer"
+
+// The actions in the todo list of the sequencer.
+const (
+  TodoPick = "pick"
+  TodoReword = "reword"
+  TodoEdit = "edit"
+  TodoSquash = "squash"
+  TodoFixup = "fixup"
+  TodoDrop = "drop"
+)
+
+// An item in the todo list, i.e. a commit to replay and how to replay it.
+type TodoItem struct {
+  Action string
+  Hash []byte
+  Subject string
+}
+
+// Sequencer keeps the state of the commands which replay a list of commits, e.g.
+// cherry-pick and rebase, so they can stop for conflicts and go on in later invocations.
+type Sequencer struct {
+  // The command which started the sequencer.
+  Command string
+  // The commit HEAD pointed to before the command started, used to abort.
+  OrigHead []byte
+  // The branch being operated, empty if HEAD was detached.
+  HeadName string `json:",omitempty"`
+  // The commit the commits are replayed onto.
+  Onto []byte `json:",omitempty"`
+  // The item being replayed, it's set when the sequencer stops.
+  Current *TodoItem `json:",omitempty"`
+  // The message collected for the commit being squashed into.
+  Message string `json:",omitempty"`
+  // Whether the sequencer has created a commit, squash and fixup can only meld into it.
+  Committed bool `json:",omitempty"`
+  // The items still to do, they are stored in a separate todo file.
+  Todo []TodoItem `json:"-"`
+}
+
+// Checks whether there's a sequencer in progress.
+func HasSequencer() bool {
+  return HasStateFile(SequencerDir)
+}
+
+// Loads the state of the sequencer, returns ErrNoSequencer if there's none in progress.
+func LoadSequencer() (*Sequencer, error) {
+  data, err := ReadStateFile(SequencerDir + "/state")
+  if err != nil {
+    return nil, ErrNoSequencer
+  }
+  seq := &Sequencer{}
+  if err = json.Unmarshal(data, seq); err != nil {
+    return nil, err
+  }
+  todo, err := ReadStateFile(SequencerDir + "/todo")
+  if err != nil {
+    return nil, ErrNoSequencer
+  }
+  if seq.Todo, err = ParseTodo(todo); err != nil {
+    return nil, err
+  }
+  return seq, nil
+}
+
+// Persists the state of the sequencer.
+func (seq *Sequencer) Save() error {
+  data, err := json.Marshal(seq)
+  if err != nil {
+    return err
+  }
+  if err = WriteStateFile(SequencerDir + "/state", data); err != nil {
+    return err
+  }
+  return WriteStateFile(SequencerDir + "/todo", FormatTodo(seq.Todo))
+}
+
+// Removes the state of the sequencer.
+func RemoveSequencer() {
+  RemoveStateFile(SequencerDir)
+}
+
+// Formats the todo list, one item per line in the form of "<action> <hash> <subject>".
+func FormatTodo(items []TodoItem) []byte {
+  var buf bytes.Buffer
+  for _, item := range(items) {
+    fmt.Fprintf(&buf, "%s %x %s\n", item.Action, item.Hash, item.Subject)
+  }
+  return buf.Bytes()
+}
+
+// Parses the todo list formatted by FormatTodo. Empty lines and lines starting with "#"
+// are ignored, actions can be abbreviated to their first letter and the hash can be
+// abbreviated.
+func ParseTodo(data []byte) ([]TodoItem, error) {
+  actions := map[string]string {
+    "p" : TodoPick, "r" : TodoReword, "e" : TodoEdit,
+    "s" : TodoSquash, "f" : TodoFixup, "d" : TodoDrop,
+    TodoPick : TodoPick, TodoReword : TodoReword, TodoEdit : TodoEdit,
+    TodoSquash : TodoSquash, TodoFixup : TodoFixup, TodoDrop : TodoDrop,
+  }
+  items := make([]TodoItem, 0)
+  for _, line := range(strings.Split(string(data), "\n")) {
+    line = strings.TrimSpace(line)
+    if line == "" || strings.HasPrefix(line, "#") {
+      continue
+    }
+    fields := strings.SplitN(line, " ", 3)
+    action, ok := actions[fields[0]]
+    if !ok || len(fields) < 2 {
+      return nil, ErrInvalidTodo
+    }
+    hash, err := hex.DecodeString(fields[1])
+    if err != nil || len(hash) != HashSize {
+      if hash, err = resolveHashPrefix(fields[1]); err != nil {
+        return nil, ErrInvalidTodo
+      }
+    }
+    item := TodoItem{Action : action, Hash : hash}
+    if len(fields) == 3 {
+      item.Subject = fields[2]
+    }
+    items = append(items, item)
+  }
+  return items, nil
+}
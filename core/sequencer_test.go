@@ -0,0 +1,98 @@
+package core
+
+import (
+  "bytes"
+  "encoding/hex"
+  "testing"
+)
+
+func TestSequencer(t *testing.T) {
+  if _, err := initTestRepo("sequencer_test"); err != nil {
+    t.Fatal(err)
+  }
+  c1, _ := commitTestFiles(map[string][]byte{"/a" : []byte("a1")}, "c1")
+  c2, _ := commitTestFiles(map[string][]byte{"/a" : []byte("a2")}, "c2")
+
+  if HasSequencer() {
+    t.Fatal("Expecting no sequencer")
+  }
+  if _, err := LoadSequencer(); err != ErrNoSequencer {
+    t.Errorf("Expecting ErrNoSequencer, got %v", err)
+  }
+  seq := &Sequencer{Command : "cherry-pick", OrigHead : c2}
+  seq.Todo = []TodoItem{{TodoPick, c1, "c1"}, {TodoSquash, c2, "c2 with spaces"}}
+  seq.Current = &TodoItem{TodoEdit, c2, "c2"}
+  if err := seq.Save(); err != nil {
+    t.Fatal(err)
+  }
+  loaded, err := LoadSequencer()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if loaded.Command != "cherry-pick" || !bytes.Equal(loaded.OrigHead, c2) ||
+     loaded.Current == nil || loaded.Current.Action != TodoEdit {
+    t.Errorf("Unexpected sequencer %+v", loaded)
+  }
+  if len(loaded.Todo) != 2 || loaded.Todo[1].Action != TodoSquash ||
+     !bytes.Equal(loaded.Todo[1].Hash, c2) || loaded.Todo[1].Subject != "c2 with spaces" {
+    t.Errorf("Unexpected todo list %+v", loaded.Todo)
+  }
+  RemoveSequencer()
+  if HasSequencer() {
+    t.Error("Expecting the sequencer to be removed")
+  }
+}
+
+func TestParseTodo(t *testing.T) {
+  if _, err := initTestRepo("parse_todo_test"); err != nil {
+    t.Fatal(err)
+  }
+  c1, _ := commitTestFiles(map[string][]byte{"/a" : []byte("a1")}, "c1")
+  todo := "# comment\n\nf " + hex.EncodeToString(c1)[:7] + " short hash\ndrop " + hex.EncodeToString(c1) + "\n"
+  items, err := ParseTodo([]byte(todo))
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(items) != 2 || items[0].Action != TodoFixup || !bytes.Equal(items[0].Hash, c1) ||
+     items[0].Subject != "short hash" || items[1].Action != TodoDrop {
+    t.Errorf("Unexpected todo list %+v", items)
+  }
+  for _, bad := range([]string{"jump " + hex.EncodeToString(c1), "pick", "pick zzzz"}) {
+    if _, err := ParseTodo([]byte(bad)); err != ErrInvalidTodo {
+      t.Errorf("Expecting ErrInvalidTodo for %q, got %v", bad, err)
+    }
+  }
+}
+
+func TestResolveRevisionRange(t *testing.T) {
+  if _, err := initTestRepo("revision_range_test"); err != nil {
+    t.Fatal(err)
+  }
+  c1, _ := commitTestFiles(map[string][]byte{"/a" : []byte("a1")}, "c1")
+  c2, _ := commitTestFiles(map[string][]byte{"/a" : []byte("a2")}, "c2")
+  c3, _ := commitTestFiles(map[string][]byte{"/a" : []byte("a3")}, "c3")
+  expected := map[string][][]byte {
+    "HEAD~2..HEAD" : {c3, c2},
+    "HEAD~2.." : {c3, c2},
+    "HEAD~1..HEAD~2" : {},
+    ".." : {},
+  }
+  for rev, hashs := range(expected) {
+    result, err := ResolveRevisionRange(rev)
+    if err != nil || len(result) != len(hashs) {
+      t.Errorf("Unexpected result for %s: %v %v", rev, len(result), err)
+      continue
+    }
+    for i := range(hashs) {
+      if !bytes.Equal(result[i], hashs[i]) {
+        t.Errorf("Unexpected commit %d for %s", i, rev)
+      }
+    }
+  }
+  if all, _ := ListCommits(nil, c3); len(all) != 3 || !bytes.Equal(all[2], c1) {
+    t.Error("Expecting all the commits")
+  }
+  if !IsRevisionRange("a..b") || IsRevisionRange("HEAD:../a") || IsRevisionRange("HEAD") {
+    t.Error("Unexpected result of IsRevisionRange")
+  }
+}
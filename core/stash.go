@@ -0,0 +1,192 @@
+package core
+
+import (
+  "bytes"
+  "encoding/hex"
+  "errors"
+  "fmt"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
+)
+
+var (
+  ErrNoStash = errors.New("core: no such stash entry")
+  ErrNoLocalChanges = errors.New("core: no local changes to save")
+)
+
+// The ref of the newest stash entry, older entries are kept in its reflog.
+const StashRef = "refs/stash"
+
+// A stash entry records the index and the tracked files in working directory as two
+// commits. The index commit has HEAD as parent, and the work tree commit has the index
+// commit as parent, so the base of the entry is the grandparent of the work tree commit.
+type Stash struct {
+  Hash []byte
+  Message string
+  WorkTree *Commit
+  Index *Commit
+  Base *Commit
+}
+
+// Creates a stash entry from the index and working directory and pushes it to the stash
+// stack. The message describes the entry, a default one is used if it's empty. Returns
+// ErrNoLocalChanges if neither the index nor the tracked files differ from HEAD.
+func CreateStash(message string) (*Stash, error) {
+  head, err := GetCurrentCommit()
+  if err != nil {
+    return nil, err
+  }
+  headHash, _ := GetHeadHash()
+  idxTree := GetIndexTree()
+
+  // The tracked files in working directory, files which are not in index are ignored.
+  workTree := NewMemTree()
+  if err = workTree.CopyFrom(idxTree, "/"); err != nil {
+    return nil, err
+  }
+  fsTree := GetFsTree()
+  fsTree.ClearCache()
+  files := flattenTree(idxTree)
+  for treePath, hash := range(files) {
+    node, err := fsTree.Get(treePath)
+    if err == ErrPathNotExist || (err == nil && node.IsDir()) {
+      if err = deleteFileAndEmptyParents(workTree, NewMemTree(), treePath); err != nil {
+        return nil, err
+      }
+    } else if err != nil {
+      return nil, err
+    } else if mode, _ := workTree.Get(treePath); !bytes.Equal(node.GetHashValue(), hash) ||
+              node.GetMode() != mode.GetMode() {
+      data, err := node.GetData()
+      if err != nil {
+        return nil, err
+      }
+      if hash, err = GetCAStore().StoreBlob(data); err != nil {
+        return nil, err
+      }
+      if err = workTree.MkFileMode(treePath, hash, node.GetMode()); err != nil {
+        return nil, err
+      }
+    }
+  }
+  if bytes.Equal(head.Tree, idxTree.GetHash()) && bytes.Equal(head.Tree, workTree.GetHash()) {
+    return nil, ErrNoLocalChanges
+  }
+
+  sig, err := GetCommitterIdent()
+  if err != nil {
+    return nil, err
+  }
+  branch, err := GetCurrentBranch()
+  if err != nil {
+    branch = "(no branch)"
+  }
+  subject := fmt.Sprintf("%x %s", headHash[:4], FirstLine(head.Comment))
+  if message == "" {
+    message = fmt.Sprintf("WIP on %s: %s", branch, subject)
+  } else {
+    message = fmt.Sprintf("On %s: %s", branch, message)
+  }
+  idxCATree, err := BuildCATree(idxTree)
+  if err != nil {
+    return nil, err
+  }
+  idxHash, err := CreateCommitObject(idxCATree.GetHash(), headHash, sig, sig,
+                                     fmt.Sprintf("index on %s: %s", branch, subject))
+  if err != nil {
+    return nil, err
+  }
+  workCATree, err := BuildCATree(workTree)
+  if err != nil {
+    return nil, err
+  }
+  hash, err := CreateCommitObject(workCATree.GetHash(), idxHash, sig, sig, message)
+  if err != nil {
+    return nil, err
+  }
+  if err = pushStash(hash, message); err != nil {
+    return nil, err
+  }
+  return GetStash(0)
+}
+
+// Gets the Nth stash entry, 0 is the newest one.
+func GetStash(n int) (*Stash, error) {
+  entries, err := ReadReflog(StashRef)
+  if err != nil {
+    return nil, err
+  }
+  if n < 0 || n >= len(entries) {
+    return nil, ErrNoStash
+  }
+  stash := &Stash{Hash : entries[n].New, Message : entries[n].Reason}
+  if stash.WorkTree, err = GetCommitObject(stash.Hash); err != nil {
+    return nil, err
+  }
+  if stash.Index = stash.WorkTree.GetPrevCommit(); stash.Index == nil {
+    return nil, ErrFileCorrupted
+  }
+  if stash.Base = stash.Index.GetPrevCommit(); stash.Base == nil {
+    return nil, ErrFileCorrupted
+  }
+  return stash, nil
+}
+
+// Gets all the stash entries, newest first.
+func ListStash() ([]*Stash, error) {
+  entries, err := ReadReflog(StashRef)
+  if err != nil {
+    return nil, err
+  }
+  stashes := make([]*Stash, len(entries))
+  for i := range(entries) {
+    if stashes[i], err = GetStash(i); err != nil {
+      return nil, err
+    }
+  }
+  return stashes, nil
+}
+
+// Removes the Nth stash entry from the stack, refs/stash is updated to the newest
+// remaining entry or deleted if there's none.
+func DropStash(n int) error {
+  if err := DeleteReflogEntry(StashRef, n); err == ErrNoReflog {
+    return ErrNoStash
+  } else if err != nil {
+    return err
+  }
+  refPath := filepath.Join(GetFleaDirectory(), filepath.FromSlash(StashRef))
+  entries, err := ReadReflog(StashRef)
+  if err != nil {
+    return err
+  }
+  if len(entries) == 0 {
+    os.Remove(getReflogPath(StashRef))
+    return os.Remove(refPath)
+  }
+  return write(refPath, []byte(hex.EncodeToString(entries[0].New)))
+}
+
+// Parses the name of a stash entry, either stash@{N} or N.
+func ParseStashName(name string) (int, error) {
+  if strings.HasPrefix(name, "stash@{") && strings.HasSuffix(name, "}") {
+    name = name[len("stash@{"):len(name) - 1]
+  }
+  n, err := strconv.Atoi(name)
+  if err != nil || n < 0 {
+    return 0, ErrNoStash
+  }
+  return n, nil
+}
+
+// Pushes the commit to the stash stack.
+func pushStash(hash []byte, message string) error {
+  refPath := filepath.Join(GetFleaDirectory(), filepath.FromSlash(StashRef))
+  old, _ := readRef(StashRef)
+  if err := write(refPath, []byte(hex.EncodeToString(hash))); err != nil {
+    return err
+  }
+  return AppendReflog(StashRef, old, hash, message)
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+  "bytes"
+  "encoding/hex"
+  "io/ioutil"
+  "os"
+  "testing"
+)
+
+func TestStash(t *testing.T) {
+  if _, err := initTestRepo("stash_test"); err != nil {
+    t.Fatal(err)
+  }
+  files := map[string][]byte{"a" : []byte("a1"), "dir/b" : []byte("b1")}
+  if err := createTempFiles(".", files); err != nil {
+    t.Fatal(err)
+  }
+  c1, _ := commitTestFiles(map[string][]byte{"/a" : []byte("a1"), "/dir/b" : []byte("b1")}, "c1")
+  if _, err := CreateStash(""); err != ErrNoLocalChanges {
+    t.Errorf("Expecting ErrNoLocalChanges, got %v", err)
+  }
+
+  // Stages a change of a, and modifies b in working directory only.
+  hashA2, _ := GetCAStore().StoreBlob([]byte("a2"))
+  GetIndexTree().MkFile("/a", hashA2)
+  ioutil.WriteFile("a", []byte("a2"), 0666)
+  ioutil.WriteFile("dir/b", []byte("b2"), 0666)
+  stash, err := CreateStash("")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if stash.Message != "WIP on master: " + hexPrefix(c1) + " c1" {
+    t.Errorf("Unexpected message %q", stash.Message)
+  }
+  if commit, _ := GetCommitObject(c1); !bytes.Equal(stash.Base.Tree, commit.Tree) {
+    t.Error("The base of stash should be HEAD")
+  }
+  if !bytes.Equal(stash.Index.Tree, GetIndexTree().GetHash()) {
+    t.Error("The index commit should have the tree of index")
+  }
+  node, err := stash.WorkTree.GetCATree().Get("/dir/b")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if data, _ := node.GetData(); string(data) != "b2" {
+    t.Errorf("Unexpected content of b in work tree commit: %s", data)
+  }
+
+  // A deleted file is recorded as deleted.
+  os.Remove("a")
+  second, err := CreateStash("second")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if _, err := second.WorkTree.GetCATree().Get("/a"); err != ErrPathNotExist {
+    t.Error("Expecting a to be deleted in the work tree commit")
+  }
+  if second.Message != "On master: second" {
+    t.Errorf("Unexpected message %q", second.Message)
+  }
+  if hash, _ := ResolveRevision("stash@{1}"); !bytes.Equal(hash, stash.Hash) {
+    t.Error("Expecting stash@{1} to be the first stash")
+  }
+
+  if err := DropStash(0); err != nil {
+    t.Fatal(err)
+  }
+  stashes, _ := ListStash()
+  if len(stashes) != 1 || !bytes.Equal(stashes[0].Hash, stash.Hash) {
+    t.Error("Expecting the first stash to be left")
+  }
+  if hash, _ := ResolveRevision("stash"); !bytes.Equal(hash, stash.Hash) {
+    t.Error("Expecting refs/stash to point to the first stash")
+  }
+  if err := DropStash(1); err != ErrNoStash {
+    t.Errorf("Expecting ErrNoStash, got %v", err)
+  }
+  DropStash(0)
+  if _, err := ResolveRevision("stash"); err != ErrUnknownRevision {
+    t.Errorf("Expecting refs/stash to be deleted, got %v", err)
+  }
+}
+
+func TestParseStashName(t *testing.T) {
+  expected := map[string]int{"stash@{0}" : 0, "stash@{12}" : 12, "3" : 3}
+  for name, n := range(expected) {
+    if m, err := ParseStashName(name); err != nil || m != n {
+      t.Errorf("Failed to parse %s: %d %v", name, m, err)
+    }
+  }
+  for _, name := range([]string{"stash", "stash@{-1}", "x"}) {
+    if _, err := ParseStashName(name); err != ErrNoStash {
+      t.Errorf("Expecting ErrNoStash for %s, got %v", name, err)
+    }
+  }
+}
+
+func hexPrefix(hash []byte) string {
+  return hex.EncodeToString(hash[:4])
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+  "encoding/json"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+)
+
+// The names of state files in .flea directory which are used by the commands spanning
+// several invocations.
+const (
+  // The commit being reverted when revert stops with conflicts.
+  RevertHeadFile = "REVERT_HEAD"
+  // The message of the commit to create when the conflicts are resolved.
+  MergeMsgFile = "MERGE_MSG"
+  // The paths which still have conflicts.
+  MergeConflictsFile = "MERGE_CONFLICTS"
+)
+
+// Writes the state file in .flea directory.
+func WriteStateFile(name string, data []byte) error {
+  fullPath := filepath.Join(GetFleaDirectory(), filepath.FromSlash(name))
+  if err := os.MkdirAll(filepath.Dir(fullPath), 0777); err != nil {
+    return err
+  }
+  return write(fullPath, data)
+}
+
+// Reads the state file in .flea directory, returns ErrFileNotExist if it doesn't exist.
+func ReadStateFile(name string) ([]byte, error) {
+  return read(filepath.Join(GetFleaDirectory(), filepath.FromSlash(name)))
+}
+
+// Checks whether the state file exists in .flea directory.
+func HasStateFile(name string) bool {
+  return exists(filepath.Join(GetFleaDirectory(), filepath.FromSlash(name)))
+}
+
+// Removes the state file, or the state directory with all its content.
+func RemoveStateFile(name string) {
+  os.RemoveAll(filepath.Join(GetFleaDirectory(), filepath.FromSlash(name)))
+}
+
+// A path which still has conflicts and the kind of the conflict.
+type UnmergedPath struct {
+  Path string
+  Kind ConflictKind
+}
+
+// Records the paths which have conflicts, the paths are sorted.
+func WriteConflicts(unmerged []UnmergedPath) error {
+  if len(unmerged) == 0 {
+    RemoveStateFile(MergeConflictsFile)
+    return nil
+  }
+  unmerged = append([]UnmergedPath(nil), unmerged...)
+  sort.Slice(unmerged, func(i, j int) bool {
+    return unmerged[i].Path < unmerged[j].Path
+  })
+  data, err := json.Marshal(unmerged)
+  if err != nil {
+    return err
+  }
+  return WriteStateFile(MergeConflictsFile, data)
+}
+
+// Gets the paths which still have conflicts along with the kinds of conflicts, the list is
+// empty if the conflicts file is missing or invalid.
+func ReadUnmergedPaths() []UnmergedPath {
+  unmerged := make([]UnmergedPath, 0)
+  if data, err := ReadStateFile(MergeConflictsFile); err == nil {
+    if json.Unmarshal(data, &unmerged) != nil {
+      return make([]UnmergedPath, 0)
+    }
+  }
+  return unmerged
+}
+
+// Gets the paths which still have conflicts.
+func ReadConflicts() []string {
+  unmerged := ReadUnmergedPaths()
+  paths := make([]string, len(unmerged))
+  for i, u := range(unmerged) {
+    paths[i] = u.Path
+  }
+  return paths
+}
+
+// Marks the conflicts of the path as resolved, if the path is a directory all the
+// conflicts under it are resolved.
+func ResolveConflicts(treePath string) error {
+  unmerged := ReadUnmergedPaths()
+  remaining := make([]UnmergedPath, 0, len(unmerged))
+  for _, u := range(unmerged) {
+    if u.Path != treePath &&
+       !strings.HasPrefix(u.Path, strings.TrimSuffix(treePath, "/") + "/") {
+      remaining = append(remaining, u)
+    }
+  }
+  if len(remaining) == len(unmerged) {
+    return nil
+  }
+  return WriteConflicts(remaining)
+}
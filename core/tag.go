@@ -0,0 +1,174 @@
+package core
+
+import (
+  "encoding/hex"
+  "encoding/json"
+  "errors"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+)
+
+var (
+  ErrTagExists = errors.New("core: tag already exists")
+  ErrTagNotExist = errors.New("core: tag doesn't exist")
+  ErrInvalidRefName = errors.New("core: invalid ref name")
+)
+
+// Annotated tag object.
+type Tag struct {
+  // Hash and type of the tagged object.
+  Object      []byte
+  Type        string
+  // Name of the tag.
+  Tag         string
+  Tagger      string
+  TaggerEmail string
+  TaggerDate  string
+  Message     string
+}
+
+// Gets the tagger of the tag.
+func (t *Tag) GetTagger() Signature {
+  return Signature{t.Tagger, t.TaggerEmail, parseStoredDate(t.TaggerDate)}
+}
+
+// Returns the Tag object of the given hash. The return values can be:
+// 1) Tag object and nil
+// 2) nil and ErrNoMatch if the hash doesn't exist.
+// 3) nil and ErrInvalidType if the hash isn't a tag object.
+func GetTagObject(hash []byte) (*Tag, error) {
+  fType, data, err := GetCAStore().Get(hash)
+  if err != nil {
+    return nil, err
+  }
+  if fType != TagType {
+    return nil, ErrInvalidType
+  }
+  var tag Tag
+  if err := json.Unmarshal(data, &tag); err != nil {
+    return nil, err
+  }
+  return &tag, nil
+}
+
+// Creates an annotated tag object pointing to target in CAStore.
+func CreateTagObject(target []byte, name string, tagger Signature, message string) ([]byte, error) {
+  fType, _, err := GetCAStore().Get(target)
+  if err != nil {
+    return nil, err
+  }
+  tag := Tag{
+    Object : target,
+    Type : fType,
+    Tag : name,
+    Tagger : tagger.Name,
+    TaggerEmail : tagger.Email,
+    TaggerDate : FormatDate(tagger.When),
+    Message : message,
+  }
+  data, err := json.Marshal(&tag)
+  if err != nil {
+    return nil, err
+  }
+  return GetCAStore().StoreTag(data)
+}
+
+// Follows tag objects until reaching an object which is not a tag. Returns the hash and
+// type of that object.
+func PeelTag(hash []byte) ([]byte, string, error) {
+  for {
+    fType, _, err := GetCAStore().Get(hash)
+    if err != nil {
+      return nil, "", err
+    }
+    if fType != TagType {
+      return hash, fType, nil
+    }
+    tag, err := GetTagObject(hash)
+    if err != nil {
+      return nil, "", err
+    }
+    hash = tag.Object
+  }
+}
+
+// Gets the hash the tag points to, it's either an annotated tag object or the object
+// of a lightweight tag.
+func GetTagRef(name string) ([]byte, error) {
+  if !IsValidRefName(name) {
+    return nil, ErrInvalidRefName
+  }
+  hash, err := readRef("refs/tags/" + name)
+  if err == ErrFileNotExist {
+    return nil, ErrTagNotExist
+  }
+  return hash, err
+}
+
+// Creates the tag pointing to hash. An existing tag is only overwritten if force is true.
+func CreateTagRef(name string, hash []byte, force bool) error {
+  if !IsValidRefName(name) {
+    return ErrInvalidRefName
+  }
+  if !GetCAStore().Exists(hash) {
+    return ErrNoMatch
+  }
+  tagPath := filepath.Join(GetTagDir(), filepath.FromSlash(name))
+  if exists(tagPath) && !force {
+    return ErrTagExists
+  }
+  if err := os.MkdirAll(filepath.Dir(tagPath), 0777); err != nil {
+    return err
+  }
+  return write(tagPath, []byte(hex.EncodeToString(hash)))
+}
+
+// Deletes the tag, the tag object stays in CAStore.
+func DeleteTagRef(name string) error {
+  if _, err := GetTagRef(name); err != nil {
+    return err
+  }
+  tagPath := filepath.Join(GetTagDir(), filepath.FromSlash(name))
+  if err := os.Remove(tagPath); err != nil {
+    return err
+  }
+  // Removes the directories of hierarchical names if they become empty.
+  for dir := filepath.Dir(tagPath); dir != GetTagDir(); dir = filepath.Dir(dir) {
+    if os.Remove(dir) != nil {
+      break
+    }
+  }
+  return nil
+}
+
+// Lists the names of all the tags in alphabetical order.
+func ListTags() []string {
+  tags := make([]string, 0)
+  walkFn := func(fsPath string, info os.FileInfo, err error) error {
+    if err != nil || info.IsDir() {
+      return nil
+    }
+    name, _ := filepath.Rel(GetTagDir(), fsPath)
+    tags = append(tags, filepath.ToSlash(name))
+    return nil
+  }
+  filepath.Walk(GetTagDir(), walkFn)
+  sort.Strings(tags)
+  return tags
+}
+
+// Checks the name of a branch or tag. Names can be hierarchical (e.g. release/v1), but
+// can't contain characters which have special meaning in revisions.
+func IsValidRefName(name string) bool {
+  if name == "" || name == "HEAD" || name == "@" || strings.HasPrefix(name, "-") {
+    return false
+  }
+  if strings.ContainsAny(name, " ~^:?*[\\\t\n") || strings.Contains(name, "..") ||
+     strings.Contains(name, "@{") || strings.Contains(name, "//") {
+    return false
+  }
+  return !strings.HasPrefix(name, "/") && !strings.HasSuffix(name, "/") &&
+         !strings.HasSuffix(name, ".")
+}
@@ -0,0 +1,67 @@
+package core
+
+import (
+  "bytes"
+  "testing"
+  "time"
+)
+
+func TestTag(t *testing.T) {
+  if _, err := initTestRepo("tag_test"); err != nil {
+    t.Fatal(err)
+  }
+  c1, _ := commitTestFiles(map[string][]byte{"/a" : []byte("a1")}, "c1")
+  c2, _ := commitTestFiles(map[string][]byte{"/a" : []byte("a2")}, "c2")
+
+  // Lightweight tag.
+  if err := CreateTagRef("v1", c1, false); err != nil {
+    t.Fatal("Failed to create tag:", err)
+  }
+  if err := CreateTagRef("v1", c2, false); err != ErrTagExists {
+    t.Error("Expecting ErrTagExists")
+  }
+  // Annotated tag.
+  tagger := Signature{"Tagger", "tagger@example.com", time.Unix(1600000000, 0)}
+  tagHash, err := CreateTagObject(c2, "release/v2", tagger, "release 2")
+  if err != nil {
+    t.Fatal("Failed to create tag object:", err)
+  }
+  CreateTagRef("release/v2", tagHash, false)
+  tag, err := GetTagObject(tagHash)
+  if err != nil || tag.Type != CommitType || bytes.Compare(tag.Object, c2) != 0 {
+    t.Error("Incorrect tag object")
+  }
+  if !tag.GetTagger().When.Equal(tagger.When) || tag.Message != "release 2" {
+    t.Error("Incorrect tagger or message")
+  }
+
+  if tags := ListTags(); len(tags) != 2 || tags[0] != "release/v2" || tags[1] != "v1" {
+    t.Error("Incorrect tag list:", tags)
+  }
+  if _, hash, err := ResolveCommit("release/v2"); err != nil || bytes.Compare(hash, c2) != 0 {
+    t.Error("Annotated tag should be peeled to the commit")
+  }
+  if hash, _ := ResolveRevision("tags/v1~0"); bytes.Compare(hash, c1) != 0 {
+    t.Error("Failed to resolve lightweight tag")
+  }
+  // A branch with the same name as a tag makes the name ambiguous.
+  UpdateBranchHead("v1", c2, "branch: Created")
+  if _, err := ResolveRevision("v1"); err == nil {
+    t.Error("Expecting ambiguous revision")
+  }
+  if hash, _ := ResolveRevision("heads/v1"); bytes.Compare(hash, c2) != 0 {
+    t.Error("Failed to resolve heads/v1")
+  }
+
+  if err := DeleteTagRef("release/v2"); err != nil {
+    t.Error("Failed to delete tag:", err)
+  }
+  if _, err := GetTagRef("release/v2"); err != ErrTagNotExist {
+    t.Error("Expecting ErrTagNotExist")
+  }
+  for _, name := range([]string{"a b", "a..b", "-x", "x^", "x@{1}", "/x", "x/"}) {
+    if IsValidRefName(name) {
+      t.Errorf("%s should be invalid ref name", name)
+    }
+  }
+}
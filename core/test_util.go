@@ -4,6 +4,7 @@ import (
   "io/ioutil"
   "os"
   "path/filepath"
+  "time"
 )
 
 var testRootDir string
@@ -36,7 +37,7 @@ func createTempFiles(dir string, files map[string][]byte) error {
       if err != nil && !os.IsExist(err) {
         return err
       }
-      err = ioutil.WriteFile(fullpath, content, 0777)
+      err = ioutil.WriteFile(fullpath, content, 0666)
       if err != nil {
         return err
       }
@@ -49,3 +50,47 @@ func mkDir(dirname string) (string, error) {
   path := filepath.Join(testRootDir, dirname)
   return path, os.Mkdir(path, 0777)
 }
+
+// Creates an empty repository in the test directory and makes it current repository.
+func initTestRepo(dirname string) (string, error) {
+  path, err := mkDir(dirname)
+  if err != nil {
+    return "", err
+  }
+  if err = os.Chdir(path); err != nil {
+    return "", err
+  }
+  // Resets the singletons bound to the previous repository.
+  caStore, indexTree, fsTree = nil, nil, nil
+  return path, InitNew()
+}
+
+// Creates a commit on top of HEAD of the master branch, the files are added to the index
+// tree before committing.
+func commitTestFiles(files map[string][]byte, comment string) ([]byte, error) {
+  idxTree := GetIndexTree()
+  for treePath, content := range(files) {
+    hash, err := GetCAStore().StoreBlob(content)
+    if err != nil {
+      return nil, err
+    }
+    if err = idxTree.MkFileAll(treePath, hash); err != nil {
+      return nil, err
+    }
+  }
+  caTree, err := BuildCATreeFromIndexFile()
+  if err != nil {
+    return nil, err
+  }
+  prev, _ := GetHeadHash()
+  sig := Signature{"Tester", "tester@example.com", time.Unix(1500000000, 0)}
+  hash, err := CreateCommitObject(caTree.GetHash(), prev, sig, sig, comment)
+  if err != nil {
+    return nil, err
+  }
+  if prev == nil {
+    WriteHeadFile([]byte("ref:master"), "")
+  }
+  UpdateBranchHead("master", hash, "commit: " + comment)
+  return hash, nil
+}
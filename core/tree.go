@@ -2,12 +2,9 @@ package core
 
 import (
   "bytes"
-  "encoding/hex"
   "errors"
   "fmt"
-  "log"
   "path"
-  "sort"
 )
 
 var (
@@ -17,6 +14,7 @@ var (
   ErrInvalidPath = errors.New("core: invalid tree path")
   ErrNodeAlreadyExist = errors.New("core: file already exists")
   ErrReadOnlyRoot = errors.New("core: root node is read-only")
+  ErrInvalidMode = errors.New("core: invalid file mode")
 )
 
 // The hash value of am empty directory.
@@ -49,6 +47,9 @@ type Node interface {
   // Checks if the node is directory.
   IsDir() bool
 
+  // Gets the mode of the node.
+  GetMode() FileMode
+
   // Converts node to readable string.
   String() string
 
@@ -59,7 +60,7 @@ type Node interface {
 // Compares two trees and returns the differences. bMisses is a list path of files which
 // are included in tree a but not tree b, aMisses is a list path of files which are
 // included tree b but not tree a, diffs is a list of path of files which are included
-// in both trees but with different hash values.
+// in both trees but with different hash values or modes.
 func CompareTrees(a Tree, b Tree) (bMisses []string, aMisses []string, diffes []string) {
   misses := make([]string, 0, 64)
   diffes = make([]string, 0, 64)
@@ -90,8 +91,8 @@ func CompareTrees(a Tree, b Tree) (bMisses []string, aMisses []string, diffes []
       // directories.
       return SkipDirNode
     }
-    if !node.IsDir() && !isHashSame {
-      // They are two files with different hash values.
+    if !node.IsDir() && (!isHashSame || node.GetMode() != peerNode.GetMode()) {
+      // They are two files with different hash values or modes.
       diffes = append(diffes, treePath)
     }
     return nil
@@ -114,39 +115,6 @@ func CompareTrees(a Tree, b Tree) (bMisses []string, aMisses []string, diffes []
   return
 }
 
-func GetDirString(node Node) string {
-  var content string
-  if node.IsDir() {
-    children := node.GetChildren()
-    names := make([]string, len(children))
-    i := 0
-    for k, _ := range(children) {
-      names[i] = k
-      i++
-    }
-    sort.Strings(names)
-    for idx, name := range(names) {
-      child, ok := children[name]
-      if !ok {
-        panic("bug?")
-      }
-      if child.IsDir() {
-        content += "tree "
-      } else {
-        content += "blob "
-      }
-      content += hex.EncodeToString(child.GetHashValue())
-      content += " " + name
-      if idx != len(names) - 1 {
-        // The last one row shouldn't contain "\n"
-        content += "\n"
-      }
-    }
-  } else {
-    log.Fatal("File node doesn't contain any data in MemTree")
-  }
-  return content
-}
 
 // Converts node to readable string.
 func String(node Node) string {
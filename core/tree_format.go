@@ -0,0 +1,172 @@
+package core
+
+import (
+  "bytes"
+  "encoding/hex"
+  "errors"
+  "log"
+  "sort"
+  "strings"
+)
+
+var (
+  ErrInvalidDirRow = errors.New("core: the number of entries per row is incorrect")
+  ErrInvalidDirString = errors.New("core: invalid dir string")
+)
+
+// The formats of dir strings. In the legacy format each entry is a "tree|blob <hash> <name>"
+// row and rows are joined by "\n", so names can't contain newlines. The version 1 format
+// starts with a header and each entry is "<mode> <hash> <name>\0", which works for any
+// name since the names of files can't contain NUL.
+const (
+  TreeFormatLegacy = 0
+  TreeFormatV1 = 1
+)
+
+// The header of dir strings in version 1 format.
+const treeFormatV1Header = "version 1\n"
+
+// An entry of the dir string.
+type DirEntry struct {
+  Name string
+  Hash []byte
+  Mode FileMode
+}
+
+// Gets the format of the dir strings written in current repository, it's configured by
+// core.repositoryformatversion. Repositories created before the version 1 format keep
+// the legacy format so the hashes of their trees don't change.
+func GetTreeFormat() int {
+  if !initialized {
+    return TreeFormatV1
+  }
+  version, err := GetConfig().GetInt("core.repositoryformatversion", TreeFormatLegacy)
+  if err != nil || version < TreeFormatV1 {
+    return TreeFormatLegacy
+  }
+  return TreeFormatV1
+}
+
+// Converts the directory node to the string stored in CAStore. Empty directories are
+// always the empty string. The legacy format is used if the repository uses it and no
+// name contains a newline.
+func GetDirString(node Node) string {
+  if !node.IsDir() {
+    log.Fatal("File node doesn't contain any data in MemTree")
+  }
+  children := node.GetChildren()
+  names := make([]string, 0, len(children))
+  legacy := GetTreeFormat() == TreeFormatLegacy
+  for name, _ := range(children) {
+    names = append(names, name)
+    if strings.Contains(name, "\n") {
+      legacy = false
+    }
+  }
+  if len(names) == 0 {
+    return ""
+  }
+  sort.Strings(names)
+  var buf bytes.Buffer
+  if legacy {
+    for idx, name := range(names) {
+      child := children[name]
+      // Regular files and directories are written without mode.
+      switch mode := child.GetMode(); mode {
+      case ModeDir:
+        buf.WriteString("tree ")
+      case ModeRegular:
+        buf.WriteString("blob ")
+      case ModeGitlink:
+        buf.WriteString(mode.String() + " commit ")
+      default:
+        buf.WriteString(mode.String() + " blob ")
+      }
+      buf.WriteString(hex.EncodeToString(child.GetHashValue()))
+      buf.WriteString(" " + name)
+      if idx != len(names) - 1 {
+        // The last one row shouldn't contain "\n"
+        buf.WriteString("\n")
+      }
+    }
+    return buf.String()
+  }
+  buf.WriteString(treeFormatV1Header)
+  for _, name := range(names) {
+    child := children[name]
+    buf.WriteString(child.GetMode().String() + " ")
+    buf.WriteString(hex.EncodeToString(child.GetHashValue()))
+    buf.WriteString(" " + name + "\x00")
+  }
+  return buf.String()
+}
+
+// Parses the dir string in any format to its entries.
+func ParseDirString(data []byte) ([]DirEntry, error) {
+  entries := make([]DirEntry, 0)
+  if len(data) == 0 {
+    // It's possible the directory is empty.
+    return entries, nil
+  }
+  if !bytes.HasPrefix(data, []byte(treeFormatV1Header)) {
+    for _, row := range(strings.Split(string(data), "\n")) {
+      entry, err := parseLegacyDirRow(row)
+      if err != nil {
+        return nil, err
+      }
+      entries = append(entries, entry)
+    }
+    return entries, nil
+  }
+  data = data[len(treeFormatV1Header):]
+  for len(data) > 0 {
+    end := bytes.IndexByte(data, 0)
+    if end == -1 {
+      return nil, ErrInvalidDirString
+    }
+    fields := strings.SplitN(string(data[:end]), " ", 3)
+    data = data[end + 1:]
+    if len(fields) != 3 || fields[2] == "" {
+      return nil, ErrInvalidDirString
+    }
+    mode, err := ParseFileMode(fields[0])
+    if err != nil {
+      return nil, err
+    }
+    hash, err := hex.DecodeString(fields[1])
+    if err != nil {
+      return nil, err
+    }
+    entries = append(entries, DirEntry{Name : fields[2], Hash : hash, Mode : mode})
+  }
+  return entries, nil
+}
+
+// Parses a row of the dir string in legacy format. Rows of directories and regular files
+// are "tree|blob <hash> <name>", other files are prefixed with their mode.
+func parseLegacyDirRow(row string) (entry DirEntry, err error) {
+  fields := strings.SplitN(row, " ", 3)
+  if len(fields) != 3 {
+    err = ErrInvalidDirRow
+    return
+  }
+  switch fields[0] {
+  case "tree":
+    entry.Mode = ModeDir
+  case "blob":
+    entry.Mode = ModeRegular
+  default:
+    if entry.Mode, err = ParseFileMode(fields[0]); err != nil {
+      return
+    }
+    // Skips the mode, the rest is "<type> <hash> <name>".
+    if fields = strings.SplitN(row, " ", 4); len(fields) != 4 {
+      err = ErrInvalidDirRow
+      return
+    }
+    fields = fields[1:]
+  }
+  entry.Name = fields[2]
+  entry.Hash, err = hex.DecodeString(fields[1])
+  return
+}
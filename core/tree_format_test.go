@@ -0,0 +1,83 @@
+package core
+
+import (
+  "bytes"
+  "encoding/hex"
+  "strings"
+  "testing"
+)
+
+func TestTreeFormat(t *testing.T) {
+  if _, err := initTestRepo("tree_format_test"); err != nil {
+    t.Fatal(err)
+  }
+  hash, _ := GetCAStore().StoreBlob([]byte("data"))
+  names := []string{"My Document.txt", "two\nlines", " lead", "trail ", "a b c"}
+  tree := NewMemTree()
+  for _, name := range(names) {
+    tree.MkFileAll("/dir/" + name, hash)
+  }
+  tree.MkFileAllMode("/dir/run", hash, ModeExec)
+  caTree, err := BuildCATree(tree)
+  if err != nil {
+    t.Fatal(err)
+  }
+  node, err := GetCATree(caTree.GetHash()).Get("/dir")
+  if err != nil {
+    t.Fatal(err)
+  }
+  children := node.GetChildren()
+  if len(children) != len(names) + 1 {
+    t.Fatal("Unexpected children", children)
+  }
+  for _, name := range(names) {
+    if child, ok := children[name]; !ok || !bytes.Equal(child.GetHashValue(), hash) {
+      t.Errorf("Missing %q", name)
+    }
+  }
+  if children["run"].GetMode() != ModeExec {
+    t.Error("The mode of run should be kept")
+  }
+
+  // Repositories of legacy format keep writing rows, unless a name contains newline.
+  GetConfig().Set(ConfigLocal, "core.repositoryformatversion", "0")
+  defer GetConfig().Set(ConfigLocal, "core.repositoryformatversion", "1")
+  legacy := NewMemTree()
+  legacy.MkFileAll("/My Document.txt", hash)
+  dirString := GetDirString(legacy.root)
+  if dirString != "blob " + hex.EncodeToString(hash) + " My Document.txt" {
+    t.Errorf("Unexpected legacy dir string %q", dirString)
+  }
+  legacy.MkFileAll("/two\nlines", hash)
+  if dirString = GetDirString(legacy.root); !strings.HasPrefix(dirString, treeFormatV1Header) {
+    t.Error("Names with newline should be written in version 1 format")
+  }
+}
+
+func TestParseDirString(t *testing.T) {
+  hash := strings.Repeat("ab", HashSize)
+  legacy := "tree " + hash + " dir\nblob " + hash + " a b\n100755 blob " + hash + " run"
+  entries, err := ParseDirString([]byte(legacy))
+  if err != nil {
+    t.Fatal(err)
+  }
+  expected := []DirEntry{{"dir", nil, ModeDir}, {"a b", nil, ModeRegular}, {"run", nil, ModeExec}}
+  if len(entries) != len(expected) {
+    t.Fatal("Unexpected entries", entries)
+  }
+  for i, entry := range(entries) {
+    if entry.Name != expected[i].Name || entry.Mode != expected[i].Mode ||
+       hex.EncodeToString(entry.Hash) != hash {
+      t.Errorf("Expecting %v, got %v", expected[i], entry)
+    }
+  }
+  if entries, _ := ParseDirString(nil); len(entries) != 0 {
+    t.Error("Expecting no entry for empty directory")
+  }
+  for _, bad := range([]string{"blob " + hash, treeFormatV1Header + "100644 " + hash + " a",
+                              treeFormatV1Header + "100644 " + hash + " \x00"}) {
+    if _, err := ParseDirString([]byte(bad)); err == nil {
+      t.Errorf("Expecting error for %q", bad)
+    }
+  }
+}
@@ -33,8 +33,25 @@ var commandsTable = map[string]cmdStruct {
   "branch"      : {fun : builtin.CmdBranch, flag : flagNeedSetup, usage: builtin.UsageBranch},
   "log"         : {fun : builtin.CmdLog, flag : flagNeedSetup, usage: builtin.UsageLog},
   "checkout"    : {fun : builtin.CmdCheckout, flag : flagNeedSetup, usage: builtin.UsageCheckout},
+  "restore"     : {fun : builtin.CmdRestore, flag : flagNeedSetup, usage: builtin.UsageRestore},
   "ls-files"    : {fun : builtin.CmdLsFiles, flag : flagNeedSetup, usage: builtin.UsageLsFiles},
   "rm"          : {fun : builtin.CmdRm, flag : flagNeedSetup, usage: builtin.UsageRm},
+  "mv"          : {fun : builtin.CmdMv, flag : flagNeedSetup, usage: builtin.UsageMv},
+  "clean"       : {fun : builtin.CmdClean, flag : flagNeedSetup, usage: builtin.UsageClean},
+  "config"      : {fun : builtin.CmdConfig, usage: builtin.UsageConfig},
+  "tag"         : {fun : builtin.CmdTag, flag : flagNeedSetup, usage: builtin.UsageTag},
+  "reflog"      : {fun : builtin.CmdReflog, flag : flagNeedSetup, usage: builtin.UsageReflog},
+  "reset"       : {fun : builtin.CmdReset, flag : flagNeedSetup, usage: builtin.UsageReset},
+  "revert"      : {fun : builtin.CmdRevert, flag : flagNeedSetup, usage: builtin.UsageRevert},
+  "cherry-pick" : {fun : builtin.CmdCherryPick, flag : flagNeedSetup, usage: builtin.UsageCherryPick},
+  "rebase"      : {fun : builtin.CmdRebase, flag : flagNeedSetup, usage: builtin.UsageRebase},
+  "stash"       : {fun : builtin.CmdStash, flag : flagNeedSetup, usage: builtin.UsageStash},
+  "diff"        : {fun : builtin.CmdDiff, flag : flagNeedSetup, usage: builtin.UsageDiff},
+  "show"        : {fun : builtin.CmdShow, flag : flagNeedSetup, usage: builtin.UsageShow},
+  "blame"       : {fun : builtin.CmdBlame, flag : flagNeedSetup, usage: builtin.UsageBlame},
+  "bisect"      : {fun : builtin.CmdBisect, flag : flagNeedSetup, usage: builtin.UsageBisect},
+  "grep"        : {fun : builtin.CmdGrep, flag : flagNeedSetup, usage: builtin.UsageGrep},
+  "archive"     : {fun : builtin.CmdArchive, flag : flagNeedSetup, usage: builtin.UsageArchive},
 }
 
 func usage() {
@@ -46,7 +63,33 @@ func usage() {
   fmt.Println("")
 }
 
+// Expands the alias defined by alias.<name> in config, os.Args is rewritten so the
+// command sees the arguments of the alias followed by the arguments given to it.
+func expandAlias(cmd string) string {
+  if _, ok := commandsTable[cmd]; ok {
+    return cmd
+  }
+  // Aliases can be defined in the config of the repository.
+  core.InitFromExisting()
+  expanded := make(map[string]bool)
+  for !expanded[cmd] {
+    if _, ok := commandsTable[cmd]; ok {
+      break
+    }
+    expanded[cmd] = true
+    alias, ok := core.GetConfig().Get("alias." + cmd)
+    fields := strings.Fields(alias)
+    if !ok || len(fields) == 0 {
+      break
+    }
+    os.Args = append(append([]string{os.Args[0]}, fields...), os.Args[2:]...)
+    cmd = fields[0]
+  }
+  return cmd
+}
+
 func runBuiltin(cmd string) {
+  cmd = expandAlias(cmd)
   if cmdSt, ok := commandsTable[cmd]; !ok {
     log.Fatal("Unkown command")
   } else {